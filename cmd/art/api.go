@@ -0,0 +1,279 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	apiCmd.Flags().StringArrayP("field", "F", nil, "Request field as key=value. Added to the query string of GET requests, and to the JSON body otherwise. Use brackets for nested fields (issue[status_id]=3). Numbers, true, false and null are converted; @file reads the value from a file. Can be repeated.")
+	apiCmd.Flags().StringP("input", "", "", "File to read the JSON request body from ('-' for stdin); --field values then go in the query string")
+	apiCmd.Flags().BoolP("paginate", "", false, "Follow offset/limit pagination of GET requests and merge the result arrays")
+	redmineCmd.AddCommand(apiCmd)
+}
+
+// parseFieldValue converts the value of a --field flag to the JSON value it
+// stands for
+func parseFieldValue(v string) (interface{}, error) {
+	switch v {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return json.Number(v), nil
+	}
+	if strings.HasPrefix(v, "@") {
+		buf, err := ioutil.ReadFile(v[1:])
+		if err != nil {
+			return nil, err
+		}
+		return string(buf), nil
+	}
+	return v, nil
+}
+
+// setField sets the possibly nested key (e.g. "issue[status_id]") of body.
+// A key ending in "[]" appends to a list.
+func setField(body map[string]interface{}, key string, value interface{}) error {
+	path := strings.Split(strings.Replace(key, "]", "", -1), "[")
+	m := body
+	for n, k := range path {
+		last := n == len(path)-1
+		if last {
+			m[k] = value
+			return nil
+		}
+		if n == len(path)-2 && path[n+1] == "" {
+			list, _ := m[k].([]interface{})
+			m[k] = append(list, value)
+			return nil
+		}
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			if _, exists := m[k]; exists {
+				return fmt.Errorf("field '%s' conflicts with a previous field", key)
+			}
+			next = make(map[string]interface{})
+			m[k] = next
+		}
+		m = next
+	}
+	return nil
+}
+
+// apiGet sends a GET request and decodes the JSON response. The error
+// includes the response body when the request failed.
+func apiGet(rm *redmine.Client, path string) (map[string]interface{}, error) {
+	res, err := rm.Request("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(buf))
+	}
+	var page map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err = dec.Decode(&page)
+	if err != nil {
+		return nil, fmt.Errorf("the response is not a JSON object: %s", err)
+	}
+	return page, nil
+}
+
+// paginate requests all the pages of the list at u, and merges the arrays
+// they contain
+func paginate(rm *redmine.Client, u *url.URL) (map[string]interface{}, error) {
+	q := u.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	var merged map[string]interface{}
+	for {
+		q.Set("offset", strconv.Itoa(offset))
+		q.Set("limit", strconv.Itoa(limit))
+		u.RawQuery = q.Encode()
+		page, err := apiGet(rm, u.String())
+		if err != nil {
+			return nil, err
+		}
+		count := 0
+		for k, v := range page {
+			list, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			if len(list) > count {
+				count = len(list)
+			}
+			if merged != nil {
+				prev, _ := merged[k].([]interface{})
+				merged[k] = append(prev, list...)
+			}
+		}
+		if merged == nil {
+			merged = page
+		}
+		total, err := strconv.Atoi(fmt.Sprint(page["total_count"]))
+		if err != nil || count == 0 || offset+count >= total {
+			break
+		}
+		offset += count
+	}
+	delete(merged, "offset")
+	delete(merged, "limit")
+	return merged, nil
+}
+
+var apiCmd = &cobra.Command{
+	Use:   "api <METHOD> <path>",
+	Short: "Send a request to the Redmine API",
+	Long: "Send a request to the Redmine API, with the endpoint and API key of the config\n" +
+		"profile, and print the JSON response. For example:\n" +
+		"\n  art redmine api GET /issues.json -F project_id=arvados -F tracker_id=1 --paginate" +
+		"\n  art redmine api PUT /issues/12345.json -F 'issue[notes]=Looks good'\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		method := strings.ToUpper(args[0])
+		switch method {
+		case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE":
+		default:
+			log.Fatalf("Error: unsupported method '%s'", args[0])
+		}
+		path := args[1]
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		u, err := url.Parse(path)
+		if err != nil {
+			log.Fatalf("Error: invalid path '%s': %s", path, err)
+		}
+		fields, err := cmd.Flags().GetStringArray("field")
+		if err != nil {
+			log.Fatalf("Error getting the field parameter: %s", err)
+		}
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			log.Fatalf("Error getting the input parameter: %s", err)
+		}
+		paginated, err := cmd.Flags().GetBool("paginate")
+		if err != nil {
+			log.Fatalf("Error getting the paginate parameter: %s", err)
+		}
+		if paginated && method != "GET" {
+			log.Fatalf("Error: --paginate is only supported for GET requests")
+		}
+
+		var payload []byte
+		if input == "-" {
+			payload, err = ioutil.ReadAll(os.Stdin)
+		} else if input != "" {
+			payload, err = ioutil.ReadFile(input)
+		}
+		if err != nil {
+			log.Fatalf("Error reading the request body: %s", err)
+		}
+		if method == "GET" || method == "HEAD" || input != "" {
+			q := u.Query()
+			for _, f := range fields {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) != 2 {
+					log.Fatalf("Error: invalid field '%s': expecting key=value", f)
+				}
+				q.Add(kv[0], kv[1])
+			}
+			u.RawQuery = q.Encode()
+		} else if len(fields) > 0 {
+			body := make(map[string]interface{})
+			for _, f := range fields {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) != 2 {
+					log.Fatalf("Error: invalid field '%s': expecting key=value", f)
+				}
+				v, err := parseFieldValue(kv[1])
+				if err != nil {
+					log.Fatalf("Error: field '%s': %s", kv[0], err)
+				}
+				err = setField(body, kv[0], v)
+				if err != nil {
+					log.Fatalf("Error: %s", err)
+				}
+			}
+			payload, err = json.Marshal(body)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+		}
+
+		rm := newRedmineClient(cmd)
+		out := newPrinter(cmd)
+		if paginated {
+			merged, err := paginate(rm, u)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			err = out.Object(merged)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			return
+		}
+
+		res, err := rm.Request(method, u.String(), payload)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		defer res.Body.Close()
+		buf, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			log.Fatalf("Error reading the response: %s", err)
+		}
+		if res.StatusCode/100 != 2 {
+			os.Stderr.Write(buf)
+			log.Fatalf("Error: %s", res.Status)
+		}
+		if len(bytes.TrimSpace(buf)) == 0 {
+			out.Infof("%s\n", res.Status)
+			return
+		}
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.UseNumber()
+		if dec.Decode(&v) != nil {
+			// Not JSON, print as is
+			os.Stdout.Write(buf)
+			return
+		}
+		err = out.Object(v)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
@@ -0,0 +1,391 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.arvados.org/arvados-dev.git/lib/gitrelease"
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+)
+
+// Values of the cells of the backport matrix
+const (
+	backportPresent = "present" // the changes are on the branch
+	backportMissing = "missing" // the changes should be on the branch, but are not
+	backportNA      = "n/a"     // the issue is not marked for backport to the branch
+)
+
+func init() {
+	rootCmd.AddCommand(backportsCmd)
+
+	backportsStatusCmd.Flags().StringArrayP("release", "r", nil, "Redmine release ID or name; its issues are expected on the staging branch of its release line (can be repeated)")
+	backportsStatusCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
+	backportsStatusCmd.Flags().StringP("field", "", "", "ID or name of the issue custom field that marks issues for backport; its values name the release lines (e.g. 2.7), a true boolean or any other text means all branches")
+	backportsStatusCmd.Flags().StringP("filter", "f", "", filterFlagHelp+" (narrows the issues selected with --field)")
+	backportsStatusCmd.Flags().StringArrayP("branch", "b", nil, "Staging branch to check (can be repeated, default: the two most recent X.Y-staging branches)")
+	addRepoFlags(backportsStatusCmd)
+	backportsCmd.AddCommand(backportsStatusCmd)
+}
+
+var backportsCmd = &cobra.Command{
+	Use:   "backports",
+	Short: "Track the backports to the maintained release lines",
+	Long: "Track the backports to the maintained release lines.\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+}
+
+var backportsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check which of the issues marked for backport are on the staging branches",
+	Long: "Check which of the issues marked for backport are on the staging branches.\n" +
+		"\nIssues are marked for backport by their release (--release \"Arvados 2.7.2\" means\n" +
+		"they belong on 2.7-staging), or by a custom field (--field) whose values name\n" +
+		"the release lines. For each issue and branch, the matrix says whether the\n" +
+		"changes are present (a merge or a cherry-pick that refers to the issue is on the\n" +
+		"branch), missing, or n/a. The commands to cherry-pick the missing changes are\n" +
+		"printed after the matrix.\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Run: func(cmd *cobra.Command, args []string) {
+		releases, err := cmd.Flags().GetStringArray("release")
+		if err != nil {
+			log.Fatalf("Error getting the release parameter: %s", err)
+		}
+		field, err := cmd.Flags().GetString("field")
+		if err != nil {
+			log.Fatalf("Error getting the field parameter: %s", err)
+		}
+		branchNames, err := cmd.Flags().GetStringArray("branch")
+		if err != nil {
+			log.Fatalf("Error getting the branch parameter: %s", err)
+		}
+		if len(releases) == 0 && field == "" {
+			log.Fatalf("Error: --release or --field is required to select the issues marked for backport")
+		}
+
+		rm := newRedmineClient(cmd)
+		out := newPrinter(cmd)
+		repo, _ := openSourceRepo(cmd, out)
+		branches := backportBranches(repo, branchNames)
+
+		project := namesProject(cmd, rm)
+		marked := make(map[int]*backportIssue)
+		mark := func(i redmine.Issue, lines []string, all bool) {
+			b := marked[i.ID]
+			if b == nil {
+				b = &backportIssue{Issue: i, Lines: make(map[string]bool)}
+				marked[i.ID] = b
+			}
+			if all {
+				b.All = true
+			}
+			for _, l := range lines {
+				b.Lines[l] = true
+			}
+		}
+		for _, name := range releases {
+			id, err := rm.ResolveRelease(project, name)
+			if err != nil {
+				log.Fatalf("Error: --release: %s", err)
+			}
+			releaseID, err := strconv.Atoi(id)
+			if err != nil {
+				log.Fatalf("Error: --release: '%s' is not a single ID", id)
+			}
+			release, err := rm.GetRelease(releaseID)
+			if err != nil {
+				log.Fatalf("Error finding release with id %d: %s", releaseID, err)
+			}
+			lines := releaseLines(release.Name)
+			if len(lines) == 0 {
+				log.Fatalf("Error: unable to find a version number in the name of release '%s'", release.Name)
+			}
+			issues, err := rm.FilteredIssues(&redmine.IssueFilter{ReleaseID: id, StatusID: "*"})
+			if err != nil {
+				log.Fatalf("Error getting the issues of release '%s': %s", release.Name, err)
+			}
+			for _, i := range issues {
+				mark(i, lines[:1], false)
+			}
+		}
+		if field != "" {
+			id, err := rm.ResolveCustomField(field)
+			if err != nil {
+				log.Fatalf("Error: --field: %s", err)
+			}
+			fieldID, _ := strconv.Atoi(id)
+			f := &redmine.IssueFilter{StatusID: "*", CustomFields: map[int]string{fieldID: "*"}}
+			applyFilterFlag(cmd, rm, f)
+			issues, err := rm.FilteredIssues(f)
+			if err != nil {
+				log.Fatalf("Error getting the issues marked for backport: %s", err)
+			}
+			for _, i := range issues {
+				v := i.CustomField(id)
+				if v == nil {
+					continue
+				}
+				for _, value := range v.Values() {
+					lines, all := fieldLines(value)
+					if all || len(lines) > 0 {
+						mark(i, lines, all)
+					}
+				}
+			}
+		}
+
+		out.Infof("Looking for the commits of %d issues\n", len(marked))
+		index, err := gitrelease.Index(repo, gitrelease.Options{CherryPicks: true})
+		if err != nil {
+			log.Fatalf("Error analyzing the repository: %s", err)
+		}
+		reachable := make([]map[plumbing.Hash]bool, len(branches))
+		for n, b := range branches {
+			reachable[n], err = gitrelease.Reachable(repo, b.Ref)
+			if err != nil {
+				log.Fatalf("Error analyzing branch %s: %s", b.Name, err)
+			}
+		}
+
+		ids := make([]int, 0, len(marked))
+		for id := range marked {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		missing := make([][]string, len(branches))
+		for _, id := range ids {
+			b := marked[id]
+			picks := backportCommits(index[id])
+			row := backportRow{ID: id, Subject: b.Issue.Subject, Commits: []string{}}
+			for _, c := range picks {
+				row.Commits = append(row.Commits, c.String()[:10])
+			}
+			for n, br := range branches {
+				status := backportNA
+				if b.All || b.Lines[br.Line()] {
+					status = backportMissing
+					if gitrelease.Shipped(index[id], reachable[n]) {
+						status = backportPresent
+					}
+				}
+				row.Branches = append(row.Branches, br.Name)
+				row.Status = append(row.Status, status)
+				if status != backportMissing {
+					continue
+				}
+				if len(picks) == 0 {
+					missing[n] = append(missing[n], fmt.Sprintf("# #%d %s: no commit found", id, b.Issue.Subject))
+				}
+				for _, c := range picks {
+					missing[n] = append(missing[n], fmt.Sprintf("%s  # #%d %s", c.cherryPick(), id, b.Issue.Subject))
+				}
+			}
+			out.Record(row)
+		}
+		err = out.Flush()
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		for n, br := range branches {
+			if len(missing[n]) == 0 {
+				continue
+			}
+			out.Infof("\nTo backport the missing changes to %s:\n\n  git checkout %s\n", br.Name, br.Name)
+			for _, m := range missing[n] {
+				out.Infof("  %s\n", m)
+			}
+		}
+	},
+}
+
+// backportIssue is an issue marked for backport to some release lines, or
+// to all of them
+type backportIssue struct {
+	Issue redmine.Issue
+	Lines map[string]bool
+	All   bool
+}
+
+// backportRow is a row of the backport matrix: the status of the issue on
+// each branch, and the commits that bring in its changes
+type backportRow struct {
+	ID       int
+	Subject  string
+	Branches []string
+	Status   []string
+	Commits  []string
+}
+
+// MarshalJSON writes the status on each branch as a field named after the
+// branch, so that the branches are the columns of the matrix
+func (r backportRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	write := func(key string, value interface{}) error {
+		k, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+		return nil
+	}
+	buf.WriteByte('{')
+	if err := write("id", r.ID); err != nil {
+		return nil, err
+	}
+	if err := write("subject", r.Subject); err != nil {
+		return nil, err
+	}
+	for n, b := range r.Branches {
+		if err := write(b, r.Status[n]); err != nil {
+			return nil, err
+		}
+	}
+	if err := write("commits", r.Commits); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var reReleaseLine = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+// releaseLines returns the release lines (X.Y) named in s, e.g. "2.7" for
+// "Arvados 2.7.2" or "2.6, 2.7" for "2.6.x, 2.7-staging"
+func releaseLines(s string) []string {
+	var lines []string
+	for _, m := range reReleaseLine.FindAllStringSubmatch(s, -1) {
+		lines = append(lines, m[1]+"."+m[2])
+	}
+	return lines
+}
+
+// fieldLines returns what a value of the --field custom field marks an
+// issue for: the release lines it names ("2.7-staging"), or all the branches
+// for a true boolean ("1", as Redmine stores them) or a text that names no
+// release line ("all"). False booleans ("0"), other numbers and empty values
+// mark nothing.
+func fieldLines(value string) (lines []string, all bool) {
+	if lines := releaseLines(value); len(lines) > 0 {
+		return lines, false
+	}
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "1", "true", "yes":
+		return nil, true
+	case "", "0", "false", "no":
+		return nil, false
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return nil, false
+	}
+	return nil, true
+}
+
+// backportBranches returns the branches to check: the named ones, or by
+// default the two most recent X.Y-staging branches
+func backportBranches(repo *git.Repository, names []string) []gitrelease.Branch {
+	staging, err := gitrelease.StagingBranches(repo)
+	if err != nil {
+		log.Fatalf("Error listing the staging branches: %s", err)
+	}
+	if len(names) == 0 {
+		if len(staging) == 0 {
+			log.Fatalf("Error: there are no X.Y-staging branches in the repository, use --branch")
+		}
+		if len(staging) > 2 {
+			staging = staging[len(staging)-2:]
+		}
+		return staging
+	}
+	var branches []gitrelease.Branch
+	for _, name := range names {
+		found := false
+		for _, b := range staging {
+			if b.Name == name {
+				branches = append(branches, b)
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		// Any other branch, with the release line in its name
+		if _, err := gitrelease.Resolve(repo, name); err != nil {
+			log.Fatalf("Error: --branch: %s", err)
+		}
+		b := gitrelease.Branch{Name: name, Ref: name, Major: -1, Minor: -1}
+		if m := reReleaseLine.FindStringSubmatch(name); m != nil {
+			b.Major, _ = strconv.Atoi(m[1])
+			b.Minor, _ = strconv.Atoi(m[2])
+		}
+		branches = append(branches, b)
+	}
+	return branches
+}
+
+// backportCommit is a commit to cherry-pick to backport the changes for an
+// issue
+type backportCommit struct {
+	plumbing.Hash
+	Merge bool
+}
+
+// cherryPick returns the command to cherry-pick the commit
+func (c backportCommit) cherryPick() string {
+	if c.Merge {
+		return "git cherry-pick -x -m 1 " + c.Hash.String()
+	}
+	return "git cherry-pick -x " + c.Hash.String()
+}
+
+// backportCommits returns the commits to cherry-pick to backport the changes
+// of refs, oldest first: the merges of the feature branches that were not
+// reverted, or else the original commits of the cherry-picks made for other
+// branches that were not reverted
+func backportCommits(refs []gitrelease.IssueRef) []backportCommit {
+	all := make(map[plumbing.Hash]bool)
+	for _, r := range refs {
+		all[r.Commit.Hash] = true
+	}
+	var merges, picks []backportCommit
+	seen := make(map[plumbing.Hash]bool)
+	// refs are most recent first
+	for n := len(refs) - 1; n >= 0; n-- {
+		r := refs[n]
+		switch {
+		case r.Kind == gitrelease.KindRevert || gitrelease.Undone(refs, all, r.Commit.Hash):
+		case r.Kind == gitrelease.KindMerge:
+			merges = append(merges, backportCommit{Hash: r.Commit.Hash, Merge: true})
+		case r.Kind == gitrelease.KindCherryPick && !seen[r.CherryPickOf]:
+			seen[r.CherryPickOf] = true
+			picks = append(picks, backportCommit{Hash: r.CherryPickOf})
+		}
+	}
+	if len(merges) > 0 {
+		return merges
+	}
+	return picks
+}
@@ -0,0 +1,165 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"git.arvados.org/arvados-dev.git/lib/gitrelease"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestReleaseLines(t *testing.T) {
+	for s, expected := range map[string][]string{
+		"Arvados 2.7.2":           {"2.7"},
+		"2.6.x, 2.7-staging":      {"2.6", "2.7"},
+		"2.10":                    {"2.10"},
+		"Arvados Future":          nil,
+		"1":                       nil,
+		"Backport to 3.0 and 3.1": {"3.0", "3.1"},
+	} {
+		if got := releaseLines(s); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected %v, got %v", s, expected, got)
+		}
+	}
+}
+
+func TestFieldLines(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		lines []string
+		all   bool
+	}{
+		{"2.7", []string{"2.7"}, false},
+		{"2.6-staging, 2.7-staging", []string{"2.6", "2.7"}, false},
+		// Boolean fields
+		{"1", nil, true},
+		{"0", nil, false},
+		{"true", nil, true},
+		{"False", nil, false},
+		// List fields
+		{"Yes", nil, true},
+		{"No", nil, false},
+		{"All", nil, true},
+		{"all maintained releases", nil, true},
+		// Numbers that name no release line
+		{"2", nil, false},
+		{"-1", nil, false},
+		{"", nil, false},
+		{" ", nil, false},
+	} {
+		lines, all := fieldLines(tc.value)
+		if !reflect.DeepEqual(lines, tc.lines) || all != tc.all {
+			t.Errorf("%q: expected %v %v, got %v %v", tc.value, tc.lines, tc.all, lines, all)
+		}
+	}
+}
+
+func TestBackportBranches(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	obj = repo.Storer.NewEncodedObject()
+	if err := (&object.Commit{Author: sig, Committer: sig, Message: "Initial commit\n", TreeHash: tree}).Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	c, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"refs/heads/main", "refs/heads/2.6-staging", "refs/heads/2.7-staging", "refs/remotes/origin/3.0-staging", "refs/heads/2.7-hotfix", "refs/heads/experiment"} {
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The two most recent staging branches by default
+	expected := []gitrelease.Branch{
+		{Name: "2.7-staging", Ref: "refs/heads/2.7-staging", Major: 2, Minor: 7},
+		{Name: "3.0-staging", Ref: "refs/remotes/origin/3.0-staging", Major: 3, Minor: 0},
+	}
+	if got := backportBranches(repo, nil); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	// Named branches, with the release line taken from the name of the
+	// ones that are not staging branches
+	expected = []gitrelease.Branch{
+		{Name: "2.6-staging", Ref: "refs/heads/2.6-staging", Major: 2, Minor: 6},
+		{Name: "2.7-hotfix", Ref: "2.7-hotfix", Major: 2, Minor: 7},
+		{Name: "experiment", Ref: "experiment", Major: -1, Minor: -1},
+	}
+	if got := backportBranches(repo, []string{"2.6-staging", "2.7-hotfix", "experiment"}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestBackportCommits(t *testing.T) {
+	commit := func(h string) *object.Commit {
+		return &object.Commit{Hash: plumbing.NewHash(h)}
+	}
+	m1, m2 := commit("01"), commit("02")
+	p1, p2, p3 := commit("11"), commit("12"), commit("13")
+	o1, o2 := plumbing.NewHash("21"), plumbing.NewHash("22")
+	r1, r2 := commit("31"), commit("32")
+	merge := func(c *object.Commit) gitrelease.IssueRef {
+		return gitrelease.IssueRef{Commit: c, Kind: gitrelease.KindMerge}
+	}
+	pick := func(c *object.Commit, of plumbing.Hash) gitrelease.IssueRef {
+		return gitrelease.IssueRef{Commit: c, Kind: gitrelease.KindCherryPick, CherryPickOf: of}
+	}
+	revert := func(c, of *object.Commit) gitrelease.IssueRef {
+		return gitrelease.IssueRef{Commit: c, Kind: gitrelease.KindRevert, RevertOf: of.Hash}
+	}
+	for name, tc := range map[string]struct {
+		refs     []gitrelease.IssueRef // most recent first
+		expected []backportCommit
+	}{
+		"no commit": {nil, nil},
+		"merges": {
+			[]gitrelease.IssueRef{merge(m2), pick(p1, o1), merge(m1)},
+			[]backportCommit{{m1.Hash, true}, {m2.Hash, true}},
+		},
+		"reverted merge": {
+			[]gitrelease.IssueRef{merge(m2), revert(r1, m1), merge(m1)},
+			[]backportCommit{{m2.Hash, true}},
+		},
+		"reverted revert": {
+			[]gitrelease.IssueRef{revert(r2, r1), revert(r1, m1), merge(m1)},
+			[]backportCommit{{m1.Hash, true}},
+		},
+		"all merges reverted": {
+			[]gitrelease.IssueRef{revert(r1, m1), pick(p1, o1), merge(m1)},
+			[]backportCommit{{o1, false}},
+		},
+		"cherry-picks": {
+			[]gitrelease.IssueRef{pick(p3, o2), pick(p2, o2), pick(p1, o1)},
+			[]backportCommit{{o1, false}, {o2, false}},
+		},
+		"reverted cherry-pick": {
+			[]gitrelease.IssueRef{revert(r1, p1), pick(p2, o2), pick(p1, o1)},
+			[]backportCommit{{o2, false}},
+		},
+	} {
+		if got := backportCommits(tc.refs); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", name, tc.expected, got)
+		}
+	}
+}
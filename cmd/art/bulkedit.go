@@ -0,0 +1,329 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.arvados.org/arvados-dev.git/lib/parallel"
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	bulkEditCmd.Flags().StringP("filter", "f", "", filterFlagHelp)
+	err := bulkEditCmd.MarkFlagRequired("filter")
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	bulkEditCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
+	bulkEditCmd.Flags().StringArrayP("set", "s", nil, "Field to change, as field=value (release, sprint, status, tracker, assignee or parent; 'none' clears a field). Can be repeated.")
+	bulkEditCmd.Flags().StringP("add-note", "n", "", "Note to add to every issue")
+	bulkEditCmd.Flags().IntP("parallel", "j", parallel.DefaultParallelism, "Number of issues to update at the same time")
+	bulkEditCmd.Flags().IntP("max-errors", "e", 5, "Stop after this many failed updates (0 for no limit)")
+	bulkEditCmd.Flags().IntP("confirm-threshold", "", 10, "Ask for confirmation before changing more than this many issues")
+	bulkEditCmd.Flags().BoolP("yes", "y", false, "Do not ask for confirmation")
+	issuesCmd.AddCommand(bulkEditCmd)
+}
+
+// bulkField describes an issue field that bulk-edit can change
+type bulkField struct {
+	// param is the name of the field in Redmine update requests
+	param string
+	// current returns the value of the field in an issue
+	current func(i *redmine.Issue) *redmine.IDName
+	// resolve converts a value given on the command line to an ID
+	resolve func(rm *redmine.Client, project, value string) (string, error)
+	// clearable fields can be set to 'none'
+	clearable bool
+}
+
+var bulkFields = map[string]bulkField{
+	"release": {
+		param:     "release_id",
+		current:   func(i *redmine.Issue) *redmine.IDName { return i.ReleaseRef() },
+		resolve:   func(rm *redmine.Client, project, v string) (string, error) { return rm.ResolveRelease(project, v) },
+		clearable: true,
+	},
+	"sprint": {
+		param:     "fixed_version_id",
+		current:   func(i *redmine.Issue) *redmine.IDName { return i.FixedVersion },
+		resolve:   func(rm *redmine.Client, project, v string) (string, error) { return rm.ResolveSprint(project, v) },
+		clearable: true,
+	},
+	"status": {
+		param:   "status_id",
+		current: func(i *redmine.Issue) *redmine.IDName { return i.Status },
+		resolve: func(rm *redmine.Client, project, v string) (string, error) { return singleID(rm.ResolveStatus(v)) },
+	},
+	"tracker": {
+		param:   "tracker_id",
+		current: func(i *redmine.Issue) *redmine.IDName { return i.Tracker },
+		resolve: func(rm *redmine.Client, project, v string) (string, error) { return singleID(rm.ResolveTracker(v)) },
+	},
+	"assignee": {
+		param:   "assigned_to_id",
+		current: func(i *redmine.Issue) *redmine.IDName { return i.AssignedTo },
+		resolve: func(rm *redmine.Client, project, v string) (string, error) {
+			if v == "me" {
+				u, err := rm.CurrentUser()
+				if err != nil {
+					return "", err
+				}
+				return strconv.Itoa(u.ID), nil
+			}
+			return rm.ResolveUser(project, v)
+		},
+		clearable: true,
+	},
+	"parent": {
+		param: "parent_issue_id",
+		current: func(i *redmine.Issue) *redmine.IDName {
+			if i.Parent == nil {
+				return nil
+			}
+			return &redmine.IDName{ID: i.Parent.ID, Name: "#" + strconv.Itoa(i.Parent.ID)}
+		},
+		resolve: func(rm *redmine.Client, project, v string) (string, error) {
+			return singleID(strings.TrimPrefix(v, "#"), nil)
+		},
+		clearable: true,
+	},
+}
+
+// singleID checks that a resolved value is a single ID, not a status class
+// or a list
+func singleID(id string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if _, err := strconv.Atoi(id); err != nil {
+		return "", fmt.Errorf("'%s' is not a single value", id)
+	}
+	return id, nil
+}
+
+// bulkChange is a field change requested on the command line
+type bulkChange struct {
+	name  string
+	field bulkField
+	id    string // empty to clear the field
+	value string // as given on the command line
+}
+
+// parseBulkChanges parses the --set flags
+func parseBulkChanges(rm *redmine.Client, project string, sets []string) ([]bulkChange, error) {
+	var changes []bulkChange
+	seen := make(map[string]bool)
+	for _, s := range sets {
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("invalid --set '%s': expecting field=value", s)
+		}
+		name := strings.ToLower(kv[0])
+		field, ok := bulkFields[name]
+		if !ok {
+			var names []string
+			for n := range bulkFields {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unsupported field '%s' (supported fields: %s)", kv[0], strings.Join(names, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("field '%s' is set more than once", name)
+		}
+		seen[name] = true
+		c := bulkChange{name: name, field: field, value: kv[1]}
+		if strings.ToLower(kv[1]) == "none" {
+			if !field.clearable {
+				return nil, fmt.Errorf("field '%s' can not be cleared", name)
+			}
+		} else {
+			id, err := field.resolve(rm, project, kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err)
+			}
+			c.id = id
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// bulkEdit is the update planned for a single issue
+type bulkEdit struct {
+	issue   redmine.Issue
+	fields  map[string]interface{}
+	summary []string
+}
+
+// planBulkEdit returns the fields of issue that differ from the requested
+// changes, and a description of each change
+func planBulkEdit(issue redmine.Issue, changes []bulkChange, note string) bulkEdit {
+	e := bulkEdit{issue: issue, fields: make(map[string]interface{})}
+	for _, c := range changes {
+		cur := c.field.current(&issue)
+		from := "-"
+		if cur != nil {
+			if strconv.Itoa(cur.ID) == c.id {
+				continue
+			}
+			from = cur.Name
+		} else if c.id == "" {
+			continue
+		}
+		to := c.value
+		if c.id == "" {
+			to = "-"
+		}
+		e.fields[c.field.param] = c.id
+		e.summary = append(e.summary, fmt.Sprintf("%s: %s -> %s", c.name, from, to))
+	}
+	// Without field changes, the note is added to every issue
+	if note != "" && (len(e.fields) > 0 || len(changes) == 0) {
+		e.fields["notes"] = note
+		e.summary = append(e.summary, "add note")
+	}
+	return e
+}
+
+var bulkEditCmd = &cobra.Command{
+	Use:   "bulk-edit",
+	Short: "Change the fields of all the issues that match a filter",
+	Long: "Change the fields of all the issues that match a filter, and/or add a note to them.\n" +
+		"\nThe changes are previewed first, and confirmation is requested when more than\n" +
+		"--confirm-threshold issues would change. For example:\n" +
+		"\n  art redmine issues bulk-edit -f 'release:\"Arvados 2.7.1\" status:open' \\" +
+		"\n    --set release=\"Arvados 2.7.2\" --add-note \"Moved to the next release\"\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Run: func(cmd *cobra.Command, args []string) {
+		sets, err := cmd.Flags().GetStringArray("set")
+		if err != nil {
+			log.Fatalf("Error getting the set parameter: %s", err)
+		}
+		note, err := cmd.Flags().GetString("add-note")
+		if err != nil {
+			log.Fatalf("Error getting the add-note parameter: %s", err)
+		}
+		if len(sets) == 0 && note == "" {
+			log.Fatalf("Error: nothing to do, use --set and/or --add-note")
+		}
+		var executor parallel.Executor
+		executor.Parallelism, err = cmd.Flags().GetInt("parallel")
+		if err != nil {
+			log.Fatalf("Error getting the parallel parameter: %s", err)
+		}
+		executor.MaxErrors, err = cmd.Flags().GetInt("max-errors")
+		if err != nil {
+			log.Fatalf("Error getting the max-errors parameter: %s", err)
+		}
+		threshold, err := cmd.Flags().GetInt("confirm-threshold")
+		if err != nil {
+			log.Fatalf("Error getting the confirm-threshold parameter: %s", err)
+		}
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Fatalf("Error getting the yes parameter: %s", err)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		rm := newRedmineClient(cmd)
+		rm.StrictNames()
+		out := newPrinter(cmd)
+		defer out.Flush()
+
+		f := redmine.IssueFilter{
+			ProjectID: projectFlag(cmd, rm),
+			StatusID:  "open",
+		}
+		applyFilterFlag(cmd, rm, &f)
+		changes, err := parseBulkChanges(rm, f.ProjectID, sets)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		issues, err := rm.FilteredIssues(&f)
+		if err != nil {
+			log.Fatalf("Error retrieving issues: %s", err)
+		}
+
+		var edits []bulkEdit
+		for _, issue := range issues {
+			e := planBulkEdit(issue, changes, note)
+			if len(e.fields) == 0 {
+				out.Record(actionResult{
+					Object:  "issue",
+					ID:      issue.ID,
+					Subject: issue.Subject,
+					Status:  statusSkipped,
+					Message: fmt.Sprintf("#%d - %s (unchanged)", issue.ID, issue.Subject),
+				})
+				continue
+			}
+			edits = append(edits, e)
+		}
+		if len(edits) == 0 {
+			out.Infof("None of the %d matching issues need changing.\n", len(issues))
+			return
+		}
+		out.Infof("%d of %d matching issues will be changed:\n", len(edits), len(issues))
+		for _, e := range edits {
+			out.Infof("  #%d - %s\n      %s\n", e.issue.ID, e.issue.Subject, strings.Join(e.summary, ", "))
+		}
+		if len(edits) > threshold && !yes && !dryRun {
+			ok, err := confirm(out, fmt.Sprintf("Change %d issues?", len(edits)))
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			if !ok {
+				log.Fatalf("Aborted")
+			}
+		}
+
+		changed := changedStatus(cmd)
+		errs, _ := executor.Run(len(edits), func(n int) error {
+			e := edits[n]
+			res := actionResult{
+				Object:  "issue",
+				ID:      e.issue.ID,
+				Subject: e.issue.Subject,
+				Status:  changed,
+				Message: fmt.Sprintf("#%d - %s: %s", e.issue.ID, e.issue.Subject, strings.Join(e.summary, ", ")),
+				URL:     fmt.Sprintf("%s/issues/%d", conf.Endpoint, e.issue.ID),
+			}
+			err := rm.UpdateIssueFields(e.issue.ID, e.fields)
+			if err != nil {
+				res.Status = statusError
+				res.Message = fmt.Sprintf("%s (%s)", res.Message, err)
+			}
+			out.Record(res)
+			return err
+		})
+		errCount := 0
+		for n, err := range errs {
+			if err == parallel.ErrSkipped {
+				e := edits[n]
+				out.Record(actionResult{
+					Object:  "issue",
+					ID:      e.issue.ID,
+					Subject: e.issue.Subject,
+					Status:  statusSkipped,
+					Message: fmt.Sprintf("#%d - %s (%s)", e.issue.ID, e.issue.Subject, err),
+				})
+			} else if err != nil {
+				errCount++
+			}
+		}
+		if errCount > 0 {
+			out.Flush()
+			log.Fatalf("Warning: %d error(s) found.", errCount)
+		}
+	},
+}
@@ -0,0 +1,186 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+// completionTTL is how long completion candidates are cached on disk
+const completionTTL = 5 * time.Minute
+
+// recentIssues is the number of recently updated issues offered for
+// completion
+const recentIssues = 50
+
+// completionFuncs maps flag names to the function that completes their value
+var completionFuncs = map[string]func(*redmine.Client, string) ([]string, error){
+	"project": func(rm *redmine.Client, project string) ([]string, error) { return completeProjects(rm) },
+	"release": completeReleases,
+	"sprint":  completeSprints,
+	"issue":   completeIssues,
+	"parent":  completeIssues,
+}
+
+// registerCompletions adds dynamic completion of Redmine IDs and names to
+// the flags of cmd and all its subcommands.
+func registerCompletions(cmd *cobra.Command) {
+	for name, complete := range completionFuncs {
+		if cmd.Flags().Lookup(name) != nil {
+			cmd.RegisterFlagCompletionFunc(name, completionFunc(name, complete))
+		}
+	}
+	for _, c := range cmd.Commands() {
+		registerCompletions(c)
+	}
+}
+
+// completionFunc returns a cobra completion function that offers the
+// candidates returned by complete, cached under the given kind
+func completionFunc(kind string, complete func(*redmine.Client, string) ([]string, error)) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if conf.Endpoint == "" || conf.ResolveApikey() != nil || conf.Apikey == "" {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		project := conf.Project
+		if f := cmd.Flags().Lookup("project"); f != nil && f.Changed && kind != "project" {
+			project = f.Value.String()
+		}
+		candidates, err := cachedCompletions(kind, project, func() ([]string, error) {
+			return complete(newRedmineClient(cmd), project)
+		})
+		if err != nil {
+			cobra.CompDebugln(err.Error(), true)
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		// Candidates are "ID\tname", and the flags accept either, so a name
+		// that starts with the word being completed is offered as is, with
+		// the ID as its description
+		var matches []string
+		lower := strings.ToLower(toComplete)
+		for _, c := range candidates {
+			id, name := c, ""
+			if i := strings.Index(c, "\t"); i >= 0 {
+				id, name = c[:i], c[i+1:]
+			}
+			switch {
+			case strings.HasPrefix(id, toComplete):
+				matches = append(matches, c)
+			case name != "" && strings.HasPrefix(strings.ToLower(name), lower):
+				matches = append(matches, name+"\t"+id)
+			}
+		}
+		return matches, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completionCache is the on-disk format of cached completion candidates
+type completionCache struct {
+	Time       time.Time `json:"time"`
+	Candidates []string  `json:"candidates"`
+}
+
+// cachedCompletions returns the candidates cached for kind and project if
+// they are recent enough, and calls fetch and caches its result otherwise.
+// The cache is kept per Redmine endpoint and API key.
+func cachedCompletions(kind, project string, fetch func() ([]string, error)) ([]string, error) {
+	var path string
+	dir, err := os.UserCacheDir()
+	if err == nil {
+		key := fmt.Sprintf("%x", sha256.Sum256([]byte(conf.Endpoint+"\n"+string(conf.Apikey))))
+		path = filepath.Join(dir, "arvados-dev", "completion", key[:16], kind+"-"+url.PathEscape(project)+".json")
+		var cache completionCache
+		buf, err := ioutil.ReadFile(path)
+		if err == nil && json.Unmarshal(buf, &cache) == nil && time.Since(cache.Time) < completionTTL {
+			return cache.Candidates, nil
+		}
+	}
+	candidates, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		buf, err := json.Marshal(completionCache{Time: time.Now(), Candidates: candidates})
+		if err == nil && os.MkdirAll(filepath.Dir(path), 0700) == nil {
+			// A cache that can not be written only makes completion slower
+			ioutil.WriteFile(path, buf, 0600)
+		}
+	}
+	return candidates, nil
+}
+
+// completion returns a completion candidate: the ID, described by name
+func completion(id int, name string) string {
+	return strconv.Itoa(id) + "\t" + name
+}
+
+func completeProjects(rm *redmine.Client) ([]string, error) {
+	projects, err := rm.Projects()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, p := range projects {
+		candidates = append(candidates, p.IDentifier+"\t"+p.Name)
+	}
+	return candidates, nil
+}
+
+func completeReleases(rm *redmine.Client, project string) ([]string, error) {
+	releases, err := rm.Releases(project)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, r := range releases {
+		if r.Status == "open" {
+			candidates = append(candidates, completion(r.ID, r.Name))
+		}
+	}
+	return candidates, nil
+}
+
+func completeSprints(rm *redmine.Client, project string) ([]string, error) {
+	p, err := rm.GetProjectByName(project)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := rm.Versions(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []string
+	for _, v := range versions {
+		if v.Status == "open" {
+			candidates = append(candidates, completion(v.ID, v.Name))
+		}
+	}
+	return candidates, nil
+}
+
+func completeIssues(rm *redmine.Client, project string) ([]string, error) {
+	f := redmine.IssueFilter{ProjectID: project, StatusID: "*", Sort: "updated_on:desc"}
+	var candidates []string
+	err := rm.EachIssue(&f, func(i redmine.Issue) error {
+		if len(candidates) >= recentIssues {
+			return redmine.ErrStop
+		}
+		candidates = append(candidates, completion(i.ID, i.Subject))
+		return nil
+	})
+	return candidates, err
+}
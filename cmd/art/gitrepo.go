@@ -0,0 +1,338 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"git.arvados.org/arvados-dev.git/lib/config"
+	"git.arvados.org/arvados-dev.git/lib/gitrelease"
+	"git.arvados.org/arvados-dev.git/lib/output"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// addRepoFlags adds the flags that select the git repository to analyze
+func addRepoFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("source-repo", "", "https://github.com/arvados/arvados.git", "Source repository to mirror (default from the config profile, if set)")
+	cmd.Flags().StringP("repo-path", "", "", "Local checkout of the source repository to analyze instead of a mirror (default from the config profile, if set)")
+	cmd.Flags().BoolP("offline", "", false, "Do not update the mirror of the source repository")
+}
+
+// addMultiRepoFlags adds the flag for the additional repositories that make
+// up a release, on top of the ones of addRepoFlags
+func addMultiRepoFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayP("repo", "", nil, "Additional repository to analyze, as URL-or-path#FROM..TO with its own range of revisions (can be repeated)")
+}
+
+// repoRange is a range of revisions of a repository to analyze
+type repoRange struct {
+	// Name is the short name of the repository, e.g. arvados-formula
+	Name string `json:"name"`
+	// Location is the URL or the local path of the repository
+	Location string `json:"location"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+
+	repo *git.Repository
+}
+
+// openSourceRepo opens the git repository selected with the --repo-path,
+// --source-repo and --offline flags. A local checkout given with
+// --repo-path is used as is. Otherwise, a bare mirror of the source
+// repository is kept in the user cache directory, and brought up to date
+// unless --offline is set.
+// The name of the repository is returned along with it.
+func openSourceRepo(cmd *cobra.Command, out *output.Printer) (*git.Repository, string) {
+	repoPath, err := cmd.Flags().GetString("repo-path")
+	if err != nil {
+		log.Fatalf("Error getting the repo-path parameter: %s", err)
+	}
+	if !cmd.Flags().Changed("repo-path") && !cmd.Flags().Changed("source-repo") {
+		repoPath = conf.RepoPath
+	}
+	if repoPath != "" {
+		out.Infof("Using the repository in %s\n", repoPath)
+		repo, err := git.PlainOpenWithOptions(config.ExpandHome(repoPath), &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			log.Fatalf("Error opening repository %s: %s", repoPath, err)
+		}
+		abs, err := filepath.Abs(config.ExpandHome(repoPath))
+		if err != nil {
+			abs = repoPath
+		}
+		return repo, repoName(abs)
+	}
+
+	url := stringFlagOrConfig(cmd, "source-repo", conf.SourceRepo)
+	offline, err := cmd.Flags().GetBool("offline")
+	if err != nil {
+		log.Fatalf("Error getting the offline parameter: %s", err)
+	}
+	repo, err := openMirror(url, offline, out)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	return repo, repoName(url)
+}
+
+// openRepoRanges opens the additional repositories given with --repo. A
+// location that is a local directory is used as is, otherwise it is
+// mirrored like --source-repo.
+func openRepoRanges(cmd *cobra.Command, out *output.Printer) []repoRange {
+	specs, err := cmd.Flags().GetStringArray("repo")
+	if err != nil {
+		log.Fatalf("Error getting the repo parameter: %s", err)
+	}
+	offline, err := cmd.Flags().GetBool("offline")
+	if err != nil {
+		log.Fatalf("Error getting the offline parameter: %s", err)
+	}
+	var ranges []repoRange
+	for _, spec := range specs {
+		rr, err := parseRepoRange(spec)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		if fi, err := os.Stat(config.ExpandHome(rr.Location)); err == nil && fi.IsDir() {
+			out.Infof("Using the repository in %s\n", rr.Location)
+			rr.repo, err = git.PlainOpenWithOptions(config.ExpandHome(rr.Location), &git.PlainOpenOptions{DetectDotGit: true})
+			if abs, err := filepath.Abs(config.ExpandHome(rr.Location)); err == nil {
+				rr.Name = repoName(abs)
+			}
+		} else {
+			rr.repo, err = openMirror(rr.Location, offline, out)
+		}
+		if err != nil {
+			log.Fatalf("Error opening repository %s: %s", rr.Location, err)
+		}
+		ranges = append(ranges, rr)
+	}
+	return ranges
+}
+
+// scanRanges finds the issue references in the ranges of revisions. It
+// returns the evidence for each issue, prefixed with the name of the
+// repository when there are several, and whether the changes for the issue
+// were reverted. The merges that state they have no issue are counted.
+func scanRanges(ranges []repoRange, opts gitrelease.Options, out *output.Printer) (map[int][]string, map[int]bool) {
+	issues := make(map[int][]string)
+	issueRefs := make(map[int][]gitrelease.IssueRef)
+	noIssue := 0
+	for _, rr := range ranges {
+		refs, err := gitrelease.Scan(rr.repo, rr.From, rr.To, opts)
+		if err != nil {
+			log.Fatalf("Error analyzing repository %s: %s", rr.Name, err)
+		}
+		prefix := ""
+		if len(ranges) > 1 {
+			prefix = rr.Name + ": "
+		}
+		for k, refs := range gitrelease.ByIssue(refs) {
+			for _, ref := range refs {
+				issues[k] = append(issues[k], prefix+ref.String())
+			}
+			issueRefs[k] = append(issueRefs[k], refs...)
+		}
+		for _, ref := range refs {
+			if ref.Issue == 0 {
+				noIssue++
+			}
+		}
+	}
+	if noIssue > 0 {
+		out.Infof("%d merge(s) without an issue (\"no issue #\")\n\n", noIssue)
+	}
+	reverted := make(map[int]bool)
+	for k, refs := range issueRefs {
+		reverted[k] = gitrelease.IsReverted(refs)
+	}
+	return issues, reverted
+}
+
+// parseRepoRange parses a --repo value, URL-or-path#FROM..TO
+func parseRepoRange(spec string) (repoRange, error) {
+	i := strings.LastIndex(spec, "#")
+	if i < 0 {
+		return repoRange{}, fmt.Errorf("missing range in repository '%s', expecting URL-or-path#FROM..TO", spec)
+	}
+	revs := strings.SplitN(spec[i+1:], "..", 2)
+	if len(revs) != 2 || revs[0] == "" || revs[1] == "" {
+		return repoRange{}, fmt.Errorf("invalid range '%s' for repository '%s', expecting FROM..TO", spec[i+1:], spec[:i])
+	}
+	return repoRange{Name: repoName(spec[:i]), Location: spec[:i], From: revs[0], To: revs[1]}, nil
+}
+
+// repoName returns the short name of the repository at location, the last
+// element of its URL or path without .git
+func repoName(location string) string {
+	location = strings.TrimSuffix(strings.TrimRight(location, "/"), ".git")
+	if i := strings.LastIndexAny(location, "/:"); i >= 0 {
+		location = location[i+1:]
+	}
+	return location
+}
+
+var reUnsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// mirrorPath returns the directory of the mirror of the repository at url
+func mirrorPath(url string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := url
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.Trim(reUnsafePathChars.ReplaceAllString(strings.TrimSuffix(name, ".git"), "_"), "_.")
+	return filepath.Join(dir, "arvados-dev", "git", name+".git"), nil
+}
+
+// openMirror opens the bare mirror of the repository at url, creating it if
+// needed. Unless offline is set, all branches and tags are fetched: only the
+// objects the mirror does not have yet are transferred.
+func openMirror(url string, offline bool, out *output.Printer) (*git.Repository, error) {
+	path, err := mirrorPath(url)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := git.PlainOpen(path)
+	if err == git.ErrRepositoryNotExists {
+		if offline {
+			return nil, fmt.Errorf("there is no mirror of %s in %s yet, it can not be used offline", url, path)
+		}
+		out.Infof("Creating a mirror of %s in %s\n", url, path)
+		repo, err = git.PlainInit(path, true)
+		if err != nil {
+			return nil, err
+		}
+		_, err = repo.CreateRemote(&gitconfig.RemoteConfig{
+			Name: "origin",
+			URLs: []string{remoteURL(url)},
+			Fetch: []gitconfig.RefSpec{
+				"+refs/heads/*:refs/heads/*",
+				"+refs/tags/*:refs/tags/*",
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("error opening the mirror in %s: %s", path, err)
+	}
+	if offline {
+		out.Infof("Using the mirror in %s without updating it\n", path)
+		return repo, nil
+	}
+	auth, err := gitAuth(remoteURL(url))
+	if err != nil {
+		return nil, fmt.Errorf("error setting up the credentials for %s: %s", url, err)
+	}
+	out.Infof("Updating the mirror of %s in %s\n", url, path)
+	err = repo.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       auth,
+		Tags:       git.AllTags,
+		Force:      true,
+		Progress:   out.Info(),
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, fmt.Errorf("error updating the mirror of %s: %s", url, err)
+	}
+	return repo, nil
+}
+
+var reSCPLikeURL = regexp.MustCompile(`^([^@/:]+@)?[^@/:]+:[^/]+$`)
+
+// remoteURL returns url in a form go-git understands: it only recognizes
+// scp-like SSH URLs whose path contains a slash, so git@host:repo.git is
+// rewritten as git@host:./repo.git, which means the same.
+func remoteURL(url string) string {
+	if reSCPLikeURL.MatchString(url) {
+		i := strings.Index(url, ":")
+		return url[:i+1] + "./" + url[i+1:]
+	}
+	return url
+}
+
+// gitAuth returns the credentials from the config profile for the
+// repository at url: for SSH remotes, the git-ssh-key private key or else
+// the ssh agent, and for HTTPS remotes, git-token (sent as the password of
+// git-username if set, or else as a bearer token). The host keys of SSH
+// remotes are verified with git-known-hosts, ~/.ssh/known_hosts by default.
+// git-token is only sent to the host of the profile's source-repo, or to
+// git-host if set, so that it does not leak to other servers.
+func gitAuth(url string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	switch ep.Protocol {
+	case "ssh":
+		var hostKeys ssh.HostKeyCallback
+		if conf.GitKnownHosts != "" {
+			hostKeys, err = knownhosts.New(config.ExpandHome(conf.GitKnownHosts))
+			if err != nil {
+				return nil, fmt.Errorf("error reading known hosts %s: %s", conf.GitKnownHosts, err)
+			}
+		}
+		user := ep.User
+		if user == "" {
+			user = "git"
+		}
+		if conf.GitSSHKey != "" {
+			auth, err := gitssh.NewPublicKeysFromFile(user, config.ExpandHome(conf.GitSSHKey), string(conf.GitSSHKeyPassphrase))
+			if err != nil {
+				return nil, fmt.Errorf("error reading SSH key %s: %s", conf.GitSSHKey, err)
+			}
+			auth.HostKeyCallback = hostKeys
+			return auth, nil
+		}
+		auth, err := gitssh.NewSSHAgentAuth(user)
+		if err != nil {
+			return nil, fmt.Errorf("%s (set git-ssh-key in the config profile to use a key file)", err)
+		}
+		auth.HostKeyCallback = hostKeys
+		return auth, nil
+	case "http", "https":
+		switch {
+		case conf.GitToken == "" || !strings.EqualFold(ep.Host, gitCredentialHost()):
+			return nil, nil
+		case conf.GitUsername == "":
+			return &githttp.TokenAuth{Token: string(conf.GitToken)}, nil
+		default:
+			return &githttp.BasicAuth{Username: conf.GitUsername, Password: string(conf.GitToken)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// gitCredentialHost returns the host git-token is for: git-host, or else
+// the host of the profile's source-repo. It is empty if neither is set.
+func gitCredentialHost() string {
+	if conf.GitHost != "" {
+		return conf.GitHost
+	}
+	if conf.SourceRepo == "" {
+		return ""
+	}
+	ep, err := transport.NewEndpoint(remoteURL(conf.SourceRepo))
+	if err != nil {
+		return ""
+	}
+	return ep.Host
+}
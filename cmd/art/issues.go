@@ -0,0 +1,463 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.arvados.org/arvados-dev.git/lib/issuequery"
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	listIssuesCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
+	listIssuesCmd.Flags().StringP("status", "s", "open", "Issue status: 'open', 'closed', '*' (any), or comma separated status names or IDs")
+	listIssuesCmd.Flags().StringP("tracker", "t", "", "Comma separated tracker names or IDs (e.g. Bug,Feature)")
+	listIssuesCmd.Flags().StringP("assignee", "a", "", "Assigned user ID or name, or 'me'")
+	listIssuesCmd.Flags().StringP("release", "r", "", "Redmine release ID or name ('!*' for issues without a release)")
+	listIssuesCmd.Flags().StringP("sprint", "", "", "Redmine sprint (aka Version) ID or name ('!*' for issues without a sprint)")
+	listIssuesCmd.Flags().StringP("parent", "", "", "Parent issue ID or subject")
+	listIssuesCmd.Flags().StringP("updated-since", "u", "", "Only issues updated since this date (YYYY-MM-DD) or for this long (e.g. 3d, 2w, 6m)")
+	listIssuesCmd.Flags().StringP("query", "q", "", "ID or name of a saved Redmine query to run")
+	listIssuesCmd.Flags().IntP("limit", "l", 0, "Maximum number of issues to list (0 for all)")
+	listIssuesCmd.Flags().StringP("filter", "f", "", filterFlagHelp)
+	issuesCmd.AddCommand(listIssuesCmd)
+}
+
+// issueRow is the summary of an issue used in issue lists
+type issueRow struct {
+	ID         int    `json:"id"`
+	Tracker    string `json:"tracker"`
+	Status     string `json:"status"`
+	Subject    string `json:"subject"`
+	AssignedTo string `json:"assigned_to"`
+	Release    string `json:"release"`
+	Sprint     string `json:"sprint"`
+	Parent     int    `json:"parent,omitempty"`
+	UpdatedOn  string `json:"updated_on"`
+}
+
+func newIssueRow(i redmine.Issue) issueRow {
+	name := func(v *redmine.IDName) string {
+		if v == nil {
+			return ""
+		}
+		return v.Name
+	}
+	row := issueRow{
+		ID:         i.ID,
+		Tracker:    name(i.Tracker),
+		Status:     name(i.Status),
+		Subject:    i.Subject,
+		AssignedTo: name(i.AssignedTo),
+		Release:    name(i.ReleaseRef()),
+		Sprint:     name(i.FixedVersion),
+		UpdatedOn:  i.UpdatedOn,
+	}
+	if i.Parent != nil {
+		row.Parent = i.Parent.ID
+	}
+	return row
+}
+
+// filterFlagHelp describes the --filter flag of the commands that select issues
+const filterFlagHelp = "Issue query, e.g. 'status:open tracker:Bug release:\"Arvados 2.7.1\" assignee:me updated:>2w'"
+
+// applyFilterFlag narrows f with the query given in the --filter flag, if any
+func applyFilterFlag(cmd *cobra.Command, rm *redmine.Client, f *redmine.IssueFilter) {
+	q, err := cmd.Flags().GetString("filter")
+	if err != nil {
+		log.Fatalf("Error getting the filter parameter: %s", err)
+	}
+	if q == "" {
+		return
+	}
+	err = issuequery.Apply(f, q, rm, time.Now())
+	if err != nil {
+		log.Fatalf("Error in filter '%s': %s", q, err)
+	}
+}
+
+var listIssuesCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List issues",
+	Long: "List the issues that match the given filters, or a saved query.\n" +
+		"\nThe --filter query is applied on top of the other flags. It is a list of\n" +
+		"key:value terms (project, status, tracker, release, sprint, assignee, parent,\n" +
+		"subject, updated, query), for example:\n" +
+		"\n  art redmine issues list -f 'tracker:Bug release:\"Arvados 2.7.1\" assignee:me'" +
+		"\n  art redmine issues list -f '-status:open updated:>2w keep-web'\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Run: func(cmd *cobra.Command, args []string) {
+		flag := func(name string) string {
+			v, err := cmd.Flags().GetString(name)
+			if err != nil {
+				log.Fatalf("Error getting the %s parameter: %s", name, err)
+			}
+			return v
+		}
+		limit, err := cmd.Flags().GetInt("limit")
+		if err != nil {
+			log.Fatalf("Error getting the limit parameter: %s", err)
+		}
+
+		rm := newRedmineClient(cmd)
+		out := newPrinter(cmd)
+		defer out.Flush()
+
+		var f redmine.IssueFilter
+		f.ProjectID = flag("project")
+		if !cmd.Flags().Changed("project") {
+			f.ProjectID = conf.Project
+		}
+		if f.ProjectID != "" {
+			f.ProjectID, err = rm.ResolveProject(f.ProjectID)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+		}
+		// resolve looks up the name given in a flag, except for the
+		// special values of Redmine filters
+		resolve := func(name string, lookup func(project, name string) (string, error)) string {
+			v := flag(name)
+			if v == "" || v == "*" || v == "!*" {
+				return v
+			}
+			id, err := lookup(f.ProjectID, v)
+			if err != nil {
+				log.Fatalf("Error: --%s: %s", name, err)
+			}
+			return id
+		}
+		if s := flag("status"); s != "" {
+			f.StatusID, err = rm.ResolveStatus(s)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+		}
+		if t := flag("tracker"); t != "" {
+			f.TrackerID, err = rm.ResolveTracker(t)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+		}
+		f.AssignedToID = resolve("assignee", rm.ResolveUser)
+		f.ReleaseID = resolve("release", rm.ResolveRelease)
+		f.VersionID = resolve("sprint", rm.ResolveSprint)
+		f.ParentID = resolve("parent", rm.ResolveIssue)
+		if u := flag("updated-since"); u != "" {
+			since, err := issuequery.RelativeDate(u, time.Now())
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+			f.UpdatedOn = ">=" + since
+		}
+		if q := flag("query"); q != "" {
+			f.QueryID, err = rm.ResolveQuery(q)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+		}
+		applyFilterFlag(cmd, rm, &f)
+
+		count := 0
+		err = rm.EachIssue(&f, func(i redmine.Issue) error {
+			if limit > 0 && count >= limit {
+				return redmine.ErrStop
+			}
+			count++
+			return out.Record(newIssueRow(i))
+		})
+		if err != nil {
+			out.Flush()
+			log.Fatalf("Error retrieving issues: %s", err)
+		}
+	},
+}
+
+// issueRef identifies a related issue in issueDetails
+type issueRef struct {
+	ID      int    `json:"id"`
+	Tracker string `json:"tracker,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Subject string `json:"subject"`
+}
+
+func (r issueRef) String() string {
+	return fmt.Sprintf("%s #%d (%s): %s", r.Tracker, r.ID, r.Status, r.Subject)
+}
+
+func newIssueRef(i redmine.Issue) issueRef {
+	row := newIssueRow(i)
+	return issueRef{ID: row.ID, Tracker: row.Tracker, Status: row.Status, Subject: row.Subject}
+}
+
+// issueDetails is everything art knows about a single issue
+type issueDetails struct {
+	issueRow
+	Priority       string `json:"priority"`
+	Author         string `json:"author"`
+	Project        string `json:"project"`
+	CreatedOn      string `json:"created_on"`
+	URL            string `json:"url"`
+	ReleaseID      int    `json:"release_id,omitempty"`
+	ReleaseEndDate string `json:"release_end_date,omitempty"`
+	ReleaseStatus  string `json:"release_status,omitempty"`
+	SprintID       int    `json:"sprint_id,omitempty"`
+	SprintDueDate  string `json:"sprint_due_date,omitempty"`
+
+	Parents    []issueRef      `json:"parents"`
+	Children   []issueRef      `json:"children"`
+	Relations  []issueRelation `json:"relations"`
+	Journals   []journalEntry  `json:"journals"`
+	Changesets []changeset     `json:"changesets"`
+}
+
+type issueRelation struct {
+	Type  string   `json:"type"`
+	Issue issueRef `json:"issue"`
+}
+
+type journalEntry struct {
+	User      string   `json:"user"`
+	CreatedOn string   `json:"created_on"`
+	Notes     string   `json:"notes,omitempty"`
+	Changes   []string `json:"changes,omitempty"`
+}
+
+type changeset struct {
+	Revision    string `json:"revision"`
+	User        string `json:"user"`
+	CommittedOn string `json:"committed_on"`
+	Comments    string `json:"comments"`
+}
+
+func (d issueDetails) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s #%d: %s\n", d.Tracker, d.ID, d.Subject)
+	fmt.Fprintf(&b, "%s\n\n", d.URL)
+	fmt.Fprintf(&b, "Project:     %s\n", d.Project)
+	fmt.Fprintf(&b, "Status:      %s\n", d.Status)
+	fmt.Fprintf(&b, "Priority:    %s\n", d.Priority)
+	fmt.Fprintf(&b, "Author:      %s\n", d.Author)
+	fmt.Fprintf(&b, "Assigned to: %s\n", d.AssignedTo)
+	if d.ReleaseID != 0 {
+		fmt.Fprintf(&b, "Release:     %s (#%d, %s, ends %s)\n", d.Release, d.ReleaseID, d.ReleaseStatus, d.ReleaseEndDate)
+	} else {
+		fmt.Fprintf(&b, "Release:     -\n")
+	}
+	if d.SprintID != 0 {
+		fmt.Fprintf(&b, "Sprint:      %s (#%d, due %s)\n", d.Sprint, d.SprintID, d.SprintDueDate)
+	} else {
+		fmt.Fprintf(&b, "Sprint:      -\n")
+	}
+	fmt.Fprintf(&b, "Created:     %s\n", d.CreatedOn)
+	fmt.Fprintf(&b, "Updated:     %s\n", d.UpdatedOn)
+
+	if len(d.Parents) > 0 {
+		fmt.Fprintf(&b, "\nParents:\n")
+		for n, p := range d.Parents {
+			fmt.Fprintf(&b, "  %s%s\n", strings.Repeat("  ", n), p)
+		}
+	}
+	if len(d.Children) > 0 {
+		fmt.Fprintf(&b, "\nSubtasks:\n")
+		for _, c := range d.Children {
+			fmt.Fprintf(&b, "  %s\n", c)
+		}
+	}
+	if len(d.Relations) > 0 {
+		fmt.Fprintf(&b, "\nRelations:\n")
+		for _, r := range d.Relations {
+			fmt.Fprintf(&b, "  %s %s\n", r.Type, r.Issue)
+		}
+	}
+	if len(d.Changesets) > 0 {
+		fmt.Fprintf(&b, "\nCommits:\n")
+		for _, c := range d.Changesets {
+			fmt.Fprintf(&b, "  %.10s %s %s: %s\n", c.Revision, c.CommittedOn, c.User, firstLine(c.Comments))
+		}
+	}
+	if len(d.Journals) > 0 {
+		fmt.Fprintf(&b, "\nRecent history:\n")
+		for _, j := range d.Journals {
+			fmt.Fprintf(&b, "  %s %s\n", j.CreatedOn, j.User)
+			for _, c := range j.Changes {
+				fmt.Fprintf(&b, "    * %s\n", c)
+			}
+			for _, l := range strings.Split(strings.TrimSpace(j.Notes), "\n") {
+				if l != "" {
+					fmt.Fprintf(&b, "    %s\n", l)
+				}
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(strings.TrimSpace(s), "\n", 2)[0]
+}
+
+func init() {
+	showIssueCmd.Flags().StringP("issue", "i", "", "Redmine issue ID or subject")
+	showIssueCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
+	showIssueCmd.Flags().IntP("journals", "j", 5, "Number of recent journal entries to show")
+	issuesCmd.AddCommand(showIssueCmd)
+}
+
+var showIssueCmd = &cobra.Command{
+	Use:   "show [issue ID or subject]",
+	Short: "Show an issue with its release, sprint, parents, subtasks, relations, commits and history",
+	Long: "Show an issue with its release, sprint, parents, subtasks, relations, commits and history.\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Args: cobra.MaximumNArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completionFunc("issue", completeIssues)(cmd, args, toComplete)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		journals, err := cmd.Flags().GetInt("journals")
+		if err != nil {
+			log.Fatalf("Error getting the journals parameter: %s", err)
+		}
+
+		rm := newRedmineClient(cmd)
+		if len(args) == 1 {
+			err = cmd.Flags().Set("issue", args[0])
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+		}
+		issueID := issueFlag(cmd, rm, namesProject(cmd, rm))
+		if issueID == 0 {
+			log.Fatalf("Error: an issue ID is required")
+		}
+		i, err := rm.GetIssueWithIncludes(issueID, "children", "relations", "journals", "changesets")
+		if err != nil {
+			log.Fatalf("Error retrieving issue %d: %s", issueID, err)
+		}
+		d, err := collectIssueDetails(rm, i, journals)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		err = newPrinter(cmd).Object(d)
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+	},
+}
+
+// collectIssueDetails looks up everything related to issue i, keeping the
+// last journals journal entries.
+func collectIssueDetails(rm *redmine.Client, i *redmine.Issue, journals int) (issueDetails, error) {
+	name := func(v *redmine.IDName) string {
+		if v == nil {
+			return ""
+		}
+		return v.Name
+	}
+	d := issueDetails{
+		issueRow:   newIssueRow(*i),
+		Priority:   name(i.Priority),
+		Author:     name(i.Author),
+		Project:    name(i.Project),
+		CreatedOn:  i.CreatedOn,
+		URL:        fmt.Sprintf("%s/issues/%d", conf.Endpoint, i.ID),
+		Parents:    []issueRef{},
+		Children:   []issueRef{},
+		Relations:  []issueRelation{},
+		Journals:   []journalEntry{},
+		Changesets: []changeset{},
+	}
+
+	if r := i.ReleaseRef(); r != nil {
+		d.ReleaseID = r.ID
+		release, err := rm.GetRelease(r.ID)
+		if err != nil {
+			return d, fmt.Errorf("error retrieving release %d: %s", r.ID, err)
+		}
+		if release != nil {
+			d.ReleaseStatus = release.Status
+			d.ReleaseEndDate = release.ReleaseEndDate
+		}
+	}
+	if i.FixedVersion != nil {
+		d.SprintID = i.FixedVersion.ID
+		v, err := rm.Version(i.FixedVersion.ID)
+		if err != nil {
+			return d, fmt.Errorf("error retrieving sprint %d: %s", i.FixedVersion.ID, err)
+		}
+		d.SprintDueDate = v.DueDate
+	}
+
+	// Walk up the parent chain, and list it starting from the top
+	seen := map[int]bool{i.ID: true}
+	for p := i.Parent; p != nil && !seen[p.ID]; {
+		seen[p.ID] = true
+		parent, err := rm.GetIssue(p.ID)
+		if err != nil {
+			return d, fmt.Errorf("error retrieving parent issue %d: %s", p.ID, err)
+		}
+		d.Parents = append([]issueRef{newIssueRef(*parent)}, d.Parents...)
+		p = parent.Parent
+	}
+
+	// The children included in the issue have no status, so look them up
+	if len(i.Children) > 0 {
+		children, err := rm.FilteredIssues(&redmine.IssueFilter{ParentID: strconv.Itoa(i.ID), StatusID: "*"})
+		if err != nil {
+			return d, fmt.Errorf("error retrieving subtasks: %s", err)
+		}
+		for _, c := range children {
+			d.Children = append(d.Children, newIssueRef(c))
+		}
+	}
+
+	for _, r := range i.Relations {
+		other := r.IssueToID
+		if other == i.ID {
+			other = r.IssueID
+		}
+		related, err := rm.GetIssue(other)
+		if err != nil {
+			// The related issue may be in a project we can not see
+			d.Relations = append(d.Relations, issueRelation{Type: r.RelationType, Issue: issueRef{ID: other}})
+			continue
+		}
+		d.Relations = append(d.Relations, issueRelation{Type: r.RelationType, Issue: newIssueRef(*related)})
+	}
+
+	for _, c := range i.Changesets {
+		d.Changesets = append(d.Changesets, changeset{
+			Revision:    c.Revision,
+			User:        name(c.User),
+			CommittedOn: c.CommittedOn,
+			Comments:    c.Comments,
+		})
+	}
+
+	start := len(i.Journals) - journals
+	if start < 0 {
+		start = 0
+	}
+	for _, j := range i.Journals[start:] {
+		e := journalEntry{User: name(j.User), CreatedOn: j.CreatedOn, Notes: j.Notes}
+		for _, detail := range j.Details {
+			e.Changes = append(e.Changes, fmt.Sprintf("%s: %s -> %s", detail.Name, detail.OldValue, detail.NewValue))
+		}
+		d.Journals = append(d.Journals, e)
+	}
+	return d, nil
+}
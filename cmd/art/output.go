@@ -0,0 +1,93 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"git.arvados.org/arvados-dev.git/lib/output"
+	survey "github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+)
+
+// Values of the actionResult Status field
+const (
+	statusOK       = "ok"
+	statusChanged  = "changed"
+	statusDryRun   = "dry-run"
+	statusSkipped  = "skipped"
+	statusError    = "error"
+	statusReverted = "reverted"
+)
+
+// actionResult is the outcome of an action on a single Redmine object. All
+// art commands that change Redmine report one actionResult per object.
+type actionResult struct {
+	Object  string      `json:"object"`
+	ID      int         `json:"id"`
+	Subject string      `json:"subject,omitempty"`
+	Field   string      `json:"field,omitempty"`
+	From    interface{} `json:"from,omitempty"`
+	To      interface{} `json:"to,omitempty"`
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	URL     string      `json:"url,omitempty"`
+}
+
+func (r actionResult) String() string {
+	return fmt.Sprintf("[%s] %s", r.Status, r.Message)
+}
+
+// newPrinter returns a printer for the format selected with --output
+func newPrinter(cmd *cobra.Command) *output.Printer {
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		log.Fatalf("Error getting the output parameter: %s", err)
+	}
+	out, err := output.New(os.Stdout, format)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	columns, err := cmd.Flags().GetStringSlice("columns")
+	if err != nil {
+		log.Fatalf("Error getting the columns parameter: %s", err)
+	}
+	out.SetColumns(columns)
+	return out
+}
+
+// changedStatus returns the status of a successful change, which is only
+// simulated when the --dry-run flag is set.
+func changedStatus(cmd *cobra.Command) string {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err == nil && dryRun {
+		return statusDryRun
+	}
+	return statusChanged
+}
+
+// optionalID returns nil for the zero ID, so that unset values are left out
+// of structured output.
+func optionalID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// confirm asks a yes/no question. The prompt is written to the info stream of
+// out, so that it does not end up in structured output.
+func confirm(out *output.Printer, message string) (bool, error) {
+	answer := false
+	prompt := &survey.Confirm{Message: message}
+	info, ok := out.Info().(*os.File)
+	if !ok {
+		info = os.Stdout
+	}
+	err := survey.AskOne(prompt, &answer, survey.WithStdio(os.Stdin, info, os.Stderr))
+	return answer, err
+}
@@ -0,0 +1,241 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"git.arvados.org/arvados-dev.git/lib/parallel"
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+// Values of the planChange Action field
+const (
+	planNew         = "new"         // the issue has no release
+	planAlreadySet  = "already-set" // the issue already has the planned release
+	planConflicting = "conflicting" // the issue has another release
+	planReverted    = "reverted"    // the changes for the issue were reverted
+)
+
+// releasePlan is the set of release changes proposed by find-and-associate
+// --plan, to be reviewed and executed by apply
+type releasePlan struct {
+	Version            int          `json:"version"`
+	CreatedAt          time.Time    `json:"created_at"`
+	Endpoint           string       `json:"endpoint"`
+	Release            redmine.ID   `json:"release"`
+	PreviousReleaseTag string       `json:"previous_release_tag,omitempty"`
+	NewReleaseCommit   string       `json:"new_release_commit,omitempty"`
+	Repos              []repoRange  `json:"repos,omitempty"`
+	Changes            []planChange `json:"changes"`
+}
+
+// planChange is the proposed release change for one issue. Only the changes
+// with Apply set are executed; it is false for conflicting changes until a
+// reviewer sets it. Applying a reverted change removes the release from the
+// issue.
+type planChange struct {
+	Issue          int             `json:"issue"`
+	Subject        string          `json:"subject"`
+	Action         string          `json:"action"`
+	CurrentRelease *redmine.IDName `json:"current_release"`
+	Apply          bool            `json:"apply"`
+	Evidence       []string        `json:"evidence,omitempty"`
+}
+
+// releasePlanVersion is the version of the plan file format
+const releasePlanVersion = 1
+
+// newPlanChange classifies the change of the release of issue to releaseID.
+// The release of a reverted issue is only removed if unassociate is set.
+func newPlanChange(issue *redmine.Issue, releaseID int, evidence []string, reverted, unassociate bool) planChange {
+	c := planChange{
+		Issue:          issue.ID,
+		Subject:        issue.Subject,
+		CurrentRelease: issue.ReleaseRef(),
+		Evidence:       evidence,
+	}
+	switch {
+	case reverted:
+		c.Action = planReverted
+		c.Apply = unassociate && c.CurrentRelease != nil && c.CurrentRelease.ID == releaseID
+	case c.CurrentRelease == nil:
+		c.Action = planNew
+		c.Apply = true
+	case c.CurrentRelease.ID == releaseID:
+		c.Action = planAlreadySet
+	default:
+		c.Action = planConflicting
+	}
+	return c
+}
+
+func writeReleasePlan(path string, plan releasePlan) error {
+	buf, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(buf, '\n'), 0644)
+}
+
+func readReleasePlan(path string) (releasePlan, error) {
+	var plan releasePlan
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return plan, err
+	}
+	err = json.Unmarshal(buf, &plan)
+	if err != nil {
+		return plan, fmt.Errorf("%s is not a valid plan: %s", path, err)
+	}
+	if plan.Version != releasePlanVersion {
+		return plan, fmt.Errorf("%s: unsupported plan version %d", path, plan.Version)
+	}
+	return plan, nil
+}
+
+func init() {
+	applyCmd.Flags().BoolP("force", "f", false, "Apply changes even to issues whose release changed since the plan was made")
+	redmineCmd.AddCommand(applyCmd)
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan.json>",
+	Short: "Execute a plan made by find-and-associate --plan",
+	Long: "Execute a plan made by 'art redmine issues find-and-associate --plan'.\n" +
+		"\nThe release of every issue marked with \"apply\": true in the plan is set. New\n" +
+		"issues are marked by default; set \"apply\" to true for the conflicting ones that\n" +
+		"should move to the release. Issues whose release changed since the plan was\n" +
+		"made are skipped, unless --force is given. For the issues whose changes were\n" +
+		"reverted (see --unassociate-reverted), \"apply\" removes the release instead.\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			log.Fatalf("Error getting the force parameter: %s", err)
+		}
+		plan, err := readReleasePlan(args[0])
+		if err != nil {
+			log.Fatalf("Error: %s", err)
+		}
+		if plan.Endpoint != conf.Endpoint {
+			log.Fatalf("Error: the plan was made for %s, not %s", plan.Endpoint, conf.Endpoint)
+		}
+
+		rm := newRedmineClient(cmd)
+		out := newPrinter(cmd)
+		defer out.Flush()
+
+		var changes []planChange
+		for _, c := range plan.Changes {
+			if c.Apply {
+				changes = append(changes, c)
+			}
+		}
+		out.Infof("Applying %d of the %d changes of the plan made on %s\n", len(changes), len(plan.Changes), plan.CreatedAt.Local().Format(time.RFC1123))
+
+		changed := changedStatus(cmd)
+		errs, _ := parallel.Executor{}.Run(len(changes), func(n int) error {
+			c := changes[n]
+			res := actionResult{
+				Object:  "issue",
+				ID:      c.Issue,
+				Subject: c.Subject,
+				Field:   "release",
+				To:      plan.Release.ID,
+				URL:     fmt.Sprintf("%s/issues/%d", conf.Endpoint, c.Issue),
+			}
+			defer func() { out.Record(res) }()
+			issue, err := rm.GetIssue(c.Issue)
+			if err != nil {
+				res.Status = statusError
+				res.Message = fmt.Sprintf("#%d: unable to retrieve issue: %s", c.Issue, err)
+				return err
+			}
+			planned, current := 0, 0
+			if c.CurrentRelease != nil {
+				planned = c.CurrentRelease.ID
+			}
+			if r := issue.ReleaseRef(); r != nil {
+				current = r.ID
+				res.From = current
+			}
+			if c.Action == planReverted {
+				res.To = nil
+				switch {
+				case current != plan.Release.ID:
+					res.Status = statusOK
+					res.Message = fmt.Sprintf("#%d: changes were reverted and the release is not %d, nothing to do", c.Issue, plan.Release.ID)
+					return nil
+				case current != planned && !force:
+					res.Status = statusSkipped
+					res.Message = fmt.Sprintf("#%d: release changed from %s to %s since the plan was made, not removing it", c.Issue, optionalRelease(planned), optionalRelease(current))
+					return nil
+				}
+				err = rm.UpdateIssueFields(c.Issue, map[string]interface{}{"release_id": ""})
+				if err != nil {
+					res.Status = statusError
+					res.Message = fmt.Sprintf("#%d: %s", c.Issue, err)
+					return err
+				}
+				res.Status = changed
+				res.Message = fmt.Sprintf("#%d: changes were reverted, release %d removed", c.Issue, plan.Release.ID)
+				return nil
+			}
+			switch {
+			case current == plan.Release.ID:
+				res.Status = statusOK
+				res.Message = fmt.Sprintf("#%d: release is already set to %d, nothing to do", c.Issue, current)
+				return nil
+			case current != planned && !force:
+				res.Status = statusSkipped
+				res.Message = fmt.Sprintf("#%d: release changed from %s to %s since the plan was made, not changing it", c.Issue, optionalRelease(planned), optionalRelease(current))
+				return nil
+			}
+			err = rm.SetRelease(*issue, plan.Release.ID)
+			if err != nil {
+				res.Status = statusError
+				res.Message = fmt.Sprintf("#%d: %s", c.Issue, err)
+				return err
+			}
+			res.Status = changed
+			res.Message = fmt.Sprintf("#%d: release set to %d", c.Issue, plan.Release.ID)
+			return nil
+		})
+		errCount := 0
+		for _, err := range errs {
+			if err != nil {
+				errCount++
+			}
+		}
+		if errCount > 0 {
+			out.Flush()
+			log.Fatalf("Warning: %d error(s) found.", errCount)
+		}
+	},
+}
+
+// optionalRelease describes a release ID, 0 meaning no release
+func optionalRelease(id int) string {
+	if id == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d", id)
+}
+
+// optionalReleaseID returns the ID of release, or nil if it is not set
+func optionalReleaseID(release *redmine.IDName) interface{} {
+	if release == nil {
+		return nil
+	}
+	return release.ID
+}
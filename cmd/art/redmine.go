@@ -6,24 +6,20 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
 	"sort"
-	"strconv"
-	"sync"
+	"strings"
 	"time"
 
+	"git.arvados.org/arvados-dev.git/lib/gitrelease"
+	"git.arvados.org/arvados-dev.git/lib/output"
+	"git.arvados.org/arvados-dev.git/lib/parallel"
 	"git.arvados.org/arvados-dev.git/lib/redmine"
-	survey "github.com/AlecAivazis/survey/v2"
 	"github.com/Masterminds/semver"
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/storer"
-	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/spf13/cobra"
 )
 
@@ -32,54 +28,50 @@ func init() {
 	redmineCmd.AddCommand(issuesCmd)
 	redmineCmd.AddCommand(releasesCmd)
 
-	associateIssueCmd.Flags().IntP("release", "r", 0, "Redmine release ID")
+	associateIssueCmd.Flags().StringP("release", "r", "", "Redmine release ID or name")
 	err := associateIssueCmd.MarkFlagRequired("release")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	associateIssueCmd.Flags().IntP("issue", "i", 0, "Redmine issue ID")
+	associateIssueCmd.Flags().StringP("issue", "i", "", "Redmine issue ID or subject")
 	err = associateIssueCmd.MarkFlagRequired("issue")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
+	associateIssueCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
 	issuesCmd.AddCommand(associateIssueCmd)
 
 
-	setIssueSprintCmd.Flags().IntP("sprint", "r", 0, "Redmine sprint ID")
+	setIssueSprintCmd.Flags().StringP("sprint", "r", "", "Redmine sprint ID or name")
 	err = setIssueSprintCmd.MarkFlagRequired("sprint")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	setIssueSprintCmd.Flags().IntP("issue", "i", 0, "Redmine issue ID")
+	setIssueSprintCmd.Flags().StringP("issue", "i", "", "Redmine issue ID or subject")
 	err = setIssueSprintCmd.MarkFlagRequired("issue")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
+	setIssueSprintCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
 	issuesCmd.AddCommand(setIssueSprintCmd)
 
-	associateOrphans.Flags().IntP("release", "r", 0, "Redmine release ID")
+	associateOrphans.Flags().StringP("release", "r", "", "Redmine release ID or name")
 	err = associateOrphans.MarkFlagRequired("release")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	associateOrphans.Flags().StringP("project", "p", "", "Redmine project name")
-	err = associateOrphans.MarkFlagRequired("project")
-	if err != nil {
-		log.Fatalf(err.Error())
-	}
-	associateOrphans.Flags().BoolP("dry-run", "", false, "Only report what will happen without making any change")
+	associateOrphans.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
+	associateOrphans.Flags().StringP("filter", "f", "", filterFlagHelp)
 	issuesCmd.AddCommand(associateOrphans)
 
-	findAndAssociateIssuesCmd.Flags().IntP("release", "r", 0, "Redmine release ID")
+	findAndAssociateIssuesCmd.Flags().StringP("release", "r", "", "Redmine release ID or name")
 	err = findAndAssociateIssuesCmd.MarkFlagRequired("release")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	findAndAssociateIssuesCmd.Flags().StringP("previous-release-tag", "p", "", "Semantic version number of the previous release")
-	err = findAndAssociateIssuesCmd.MarkFlagRequired("previous-release-tag")
-	if err != nil {
-		log.Fatalf(err.Error())
-	}
+	findAndAssociateIssuesCmd.Flags().StringP("project", "", "", "Redmine project identifier, name or ID (default from the config profile)")
+	findAndAssociateIssuesCmd.Flags().StringP("previous-release-tag", "p", "", "Semantic version number of the previous release (default: the release tag before the version in the release name)")
+	findAndAssociateIssuesCmd.Flags().BoolP("yes", "y", false, "Use the inferred previous release tag without asking for confirmation")
 	findAndAssociateIssuesCmd.Flags().StringP("new-release-commit", "n", "", "Git commit for the new release")
 	err = findAndAssociateIssuesCmd.MarkFlagRequired("new-release-commit")
 	if err != nil {
@@ -87,7 +79,11 @@ func init() {
 	}
 	findAndAssociateIssuesCmd.Flags().BoolP("auto-set", "a", false, "Associate issues without existing release without prompting")
 	findAndAssociateIssuesCmd.Flags().BoolP("skip-release-change", "s", false, "Skip issues already assigned to another release (do not prompt)")
-	findAndAssociateIssuesCmd.Flags().StringP("source-repo", "", "https://github.com/arvados/arvados.git", "Source repository to clone from")
+	addRepoFlags(findAndAssociateIssuesCmd)
+	addMultiRepoFlags(findAndAssociateIssuesCmd)
+	findAndAssociateIssuesCmd.Flags().BoolP("unassociate-reverted", "", false, "Remove the release from issues whose changes were reverted")
+	findAndAssociateIssuesCmd.Flags().BoolP("cherry-picks", "", false, "Also look for fixes cherry-picked with 'git cherry-pick -x' (e.g. on X.Y-staging branches)")
+	findAndAssociateIssuesCmd.Flags().StringP("plan", "", "", "Write the proposed release changes to this file instead of making them (see 'art redmine apply')")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
@@ -99,23 +95,20 @@ func init() {
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	createReleaseIssueCmd.Flags().IntP("sprint", "s", 0, "Redmine sprint (aka Version) ID")
+	createReleaseIssueCmd.Flags().StringP("sprint", "s", "", "Redmine sprint (aka Version) ID or name")
 	err = createReleaseIssueCmd.MarkFlagRequired("sprint")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	createReleaseIssueCmd.Flags().StringP("project", "p", "", "Redmine project name")
-	err = createReleaseIssueCmd.MarkFlagRequired("project")
-	if err != nil {
-		log.Fatalf(err.Error())
-	}
+	createReleaseIssueCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
 	issuesCmd.AddCommand(createReleaseIssueCmd)
 
-	getReleaseCmd.Flags().IntP("release", "r", 0, "ID of the redmine release")
+	getReleaseCmd.Flags().StringP("release", "r", "", "ID or name of the redmine release")
 	err = getReleaseCmd.MarkFlagRequired("release")
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
+	getReleaseCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
 	releasesCmd.AddCommand(getReleaseCmd)
 }
 
@@ -126,22 +119,34 @@ var redmineCmd = &cobra.Command{
 		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
 		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		if conf.Endpoint == "" {
-			cmd.Help()
-			fmt.Println()
-			fmt.Println("Error: the REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server")
-			os.Exit(1)
-		}
-		if conf.Apikey == "" {
-			cmd.Help()
-			fmt.Println()
-			fmt.Println("Error: the REDMINE_APIKEY environment variable must be set to your redmine API key")
-			os.Exit(1)
-		}
+		checkRedmineConfig(cmd)
 		return nil
 	},
 }
 
+// checkRedmineConfig exits with an error message if the redmine endpoint or
+// API key are not configured. The usage goes to stderr along with the
+// error, to keep it out of structured output.
+func checkRedmineConfig(cmd *cobra.Command) {
+	err := conf.ResolveApikey()
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	var msg string
+	switch {
+	case conf.Endpoint == "":
+		msg = "the REDMINE_ENDPOINT environment variable (or endpoint in the config profile) must be set to the base URL of your redmine server"
+	case conf.Apikey == "":
+		msg = "the REDMINE_APIKEY environment variable (or apikey in the config profile) must be set to your redmine API key"
+	default:
+		return
+	}
+	cmd.SetOut(os.Stderr)
+	cmd.Help()
+	fmt.Fprintln(os.Stderr)
+	log.Fatalf("Error: %s", msg)
+}
+
 var issuesCmd = &cobra.Command{
 	Use:   "issues",
 	Short: "Manage Redmine issues",
@@ -154,24 +159,17 @@ var associateOrphans = &cobra.Command{
 	Use:   "associate-orphans", // FIXME
 	Short: "Find open issues without a release and version, assign them to the given release",
 	Long: "Find open issues without a release and version, assign them to the given release.\n" +
+		"\nThe issues can be narrowed down (or the defaults overridden) with --filter,\n" +
+		"e.g. --filter 'tracker:Bug updated:>1m'.\n" +
 		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
 		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
 	Run: func(cmd *cobra.Command, args []string) {
-		rID, err := cmd.Flags().GetInt("release")
-		if err != nil {
-			fmt.Printf("Error converting Redmine release ID to integer: %s", err)
-			os.Exit(1)
-		}
-		pName, err := cmd.Flags().GetString("project")
-		if err != nil {
-			log.Fatalf("Error getting the requested project name: %s", err)
-		}
-		dryRun, err := cmd.Flags().GetBool("dry-run")
-		if err != nil {
-			log.Fatalf("Error getting the dry-run parameter")
-		}
-
-		rm := redmine.NewClient(conf.Endpoint, conf.Apikey)
+		rm := newRedmineClient(cmd)
+		rm.StrictNames()
+		pName := projectFlag(cmd, rm)
+		rID := releaseFlag(cmd, rm, pName)
+		out := newPrinter(cmd)
+		defer out.Flush()
 		p, err := rm.GetProjectByName(pName)
 		if err != nil {
 			log.Fatalf("Error retrieving project ID for '%s': %s", pName, err)
@@ -191,88 +189,41 @@ var associateOrphans = &cobra.Command{
 			VersionID: "!*",
 			ParentID:  "!*",
 		}
+		applyFilterFlag(cmd, rm, &flt)
 		issues, err := rm.FilteredIssues(&flt)
 		if err != nil {
-			fmt.Printf("Error requesting unassigned open issues from project %d: %s", p.ID, err)
-		}
-		fmt.Printf("Found %d issues from project '%s' to assign to release '%s'...\n", len(issues), p.Name, r.Name)
-
-		type job struct {
-			issue  redmine.Issue
-			rID    int
-			dryRun bool
-		}
-		type result struct {
-			msg     string
-			success bool
-		}
-		var wg sync.WaitGroup
-		jobs := make(chan job, len(issues))
-		results := make(chan result, len(issues))
-
-		worker := func(id int, jobs <-chan job, results chan<- result) {
-			for j := range jobs {
-				msg := fmt.Sprintf("#%d - %s ", j.issue.ID, j.issue.Subject)
-				success := true
-				if !j.dryRun {
-					err = rm.SetRelease(j.issue, j.rID)
-					if err != nil {
-						success = false
-						msg = fmt.Sprintf("%s [error] (%s)\n", msg, err)
-					} else {
-						msg = fmt.Sprintf("%s [changed]\n", msg)
-					}
-				} else {
-					msg = fmt.Sprintf("%s [skipped]\n", msg)
-				}
-				results <- result{
-					msg:     msg,
-					success: success,
-				}
+			log.Fatalf("Error requesting unassigned open issues from project %d: %s", p.ID, err)
+		}
+		out.Infof("Found %d issues from project '%s' to assign to release '%s'...\n", len(issues), p.Name, r.Name)
+
+		changed := changedStatus(cmd)
+		errs, _ := parallel.Executor{}.Run(len(issues), func(n int) error {
+			issue := issues[n]
+			res := actionResult{
+				Object:  "issue",
+				ID:      issue.ID,
+				Subject: issue.Subject,
+				Field:   "release",
+				To:      rID,
+				Status:  changed,
+				Message: fmt.Sprintf("#%d - %s", issue.ID, issue.Subject),
 			}
-		}
-
-		wn := 8
-		if len(issues) < wn {
-			wn = len(issues)
-		}
-		for w := 1; w <= wn; w++ {
-			wg.Add(1)
-			w := w
-			go func() {
-				defer wg.Done()
-				worker(w, jobs, results)
-			}()
-		}
-
-		for _, issue := range issues {
-			jobs <- job{
-				issue:  issue,
-				rID:    rID,
-				dryRun: dryRun,
+			err := rm.SetRelease(issue, rID)
+			if err != nil {
+				res.Status = statusError
+				res.Message = fmt.Sprintf("%s (%s)", res.Message, err)
 			}
-		}
-		close(jobs)
-
-		succeded := true
+			out.Record(res)
+			return err
+		})
+		out.Flush()
 		errCount := 0
-		var wg2 sync.WaitGroup
-		wg2.Add(1)
-		go func() {
-			defer wg2.Done()
-			for r := range results {
-				fmt.Printf(r.msg)
-				if !r.success {
-					succeded = false
-					errCount += 1
-				}
+		for _, e := range errs {
+			if e != nil {
+				errCount++
 			}
-		}()
-
-		wg.Wait()
-		close(results)
-		wg2.Wait()
-		if !succeded {
+		}
+		if errCount > 0 {
 			log.Fatalf("Warning: %d error(s) found.", errCount)
 		}
 	},
@@ -285,43 +236,41 @@ var associateIssueCmd = &cobra.Command{
 		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
 		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
 	Run: func(cmd *cobra.Command, args []string) {
-		issueID, err := cmd.Flags().GetInt("issue")
-		if err != nil {
-			fmt.Printf("Error converting Redmine issue ID to integer: %s", err)
-			os.Exit(1)
-		}
-
-		releaseID, err := cmd.Flags().GetInt("release")
-		if err != nil {
-			fmt.Printf("Error converting Redmine release ID to integer: %s", err)
-			os.Exit(1)
-		}
-
-		redmine := redmine.NewClient(conf.Endpoint, conf.Apikey)
+		redmine := newRedmineClient(cmd)
+		redmine.StrictNames()
+		project := namesProject(cmd, redmine)
+		issueID := issueFlag(cmd, redmine, project)
+		releaseID := releaseFlag(cmd, redmine, project)
+		out := newPrinter(cmd)
+		defer out.Flush()
 
 		i, err := redmine.GetIssue(issueID)
 		if err != nil {
-			fmt.Printf("%s\n", err.Error())
-			os.Exit(1)
+			log.Fatalf("Error retrieving issue %d: %s", issueID, err)
 		}
 
+		res := actionResult{Object: "issue", ID: i.ID, Subject: i.Subject, Field: "release", To: releaseID}
 		var setIt bool
 		if i.Release == nil || i.Release["release"].ID == 0 {
 			setIt = true
 		} else if i.Release["release"].ID != releaseID {
 			setIt = true
+			res.From = i.Release["release"].ID
 		}
 		if setIt {
 			err = redmine.SetRelease(*i, releaseID)
 			if err != nil {
-				fmt.Printf("%s\n", err.Error())
-				os.Exit(1)
+				log.Fatalf("Error setting the release of issue %d: %s", i.ID, err)
 			} else {
-				fmt.Printf("[changed] release for issue %d set to %d\n", i.ID, releaseID)
+				res.Status = changedStatus(cmd)
+				res.Message = fmt.Sprintf("release for issue %d set to %d", i.ID, releaseID)
 			}
 		} else {
-			fmt.Printf("[ok] release for issue %d was already set to %d, not updating\n", i.ID, i.Release["release"].ID)
+			res.From = i.Release["release"].ID
+			res.Status = statusOK
+			res.Message = fmt.Sprintf("release for issue %d was already set to %d, not updating", i.ID, i.Release["release"].ID)
 		}
+		out.Record(res)
 	},
 }
 
@@ -333,57 +282,53 @@ var setIssueSprintCmd = &cobra.Command{
 		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
 		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
 	Run: func(cmd *cobra.Command, args []string) {
-		issueID, err := cmd.Flags().GetInt("issue")
-		if err != nil {
-			fmt.Printf("Error converting Redmine issue ID to integer: %s", err)
-			os.Exit(1)
-		}
-
-		sprintID, err := cmd.Flags().GetInt("sprint")
-		if err != nil {
-			fmt.Printf("Error converting Redmine sprint ID to integer: %s", err)
-			os.Exit(1)
-		}
-
-		redmine := redmine.NewClient(conf.Endpoint, conf.Apikey)
+		redmine := newRedmineClient(cmd)
+		redmine.StrictNames()
+		project := namesProject(cmd, redmine)
+		issueID := issueFlag(cmd, redmine, project)
+		sprintID := sprintFlag(cmd, redmine, project)
+		out := newPrinter(cmd)
+		defer out.Flush()
 
 		i, err := redmine.GetIssue(issueID)
 		if err != nil {
-			fmt.Printf("%s\n", err.Error())
-			os.Exit(1)
+			log.Fatalf("Error retrieving issue %d: %s", issueID, err)
 		}
 
+		res := actionResult{Object: "issue", ID: i.ID, Subject: i.Subject, Field: "sprint", To: sprintID}
 		var setIt bool
 		if i.FixedVersion == nil {
 			setIt = true
 		} else if i.FixedVersion.ID != sprintID {
 			setIt = true
+			res.From = i.FixedVersion.ID
 		}
 		if setIt {
 			err = redmine.SetSprint(*i, sprintID)
 			if err != nil {
-				fmt.Printf("%s\n", err.Error())
-				os.Exit(1)
+				log.Fatalf("Error setting the sprint of issue %d: %s", i.ID, err)
 			} else {
-				fmt.Printf("[changed] sprint for issue %d set to %d\n", i.ID, sprintID)
+				res.Status = changedStatus(cmd)
+				res.Message = fmt.Sprintf("sprint for issue %d set to %d", i.ID, sprintID)
 			}
 		} else {
-			fmt.Printf("[ok] sprint for issue %d was already set to %d, not updating\n", i.ID, i.FixedVersion.ID)
+			res.From = i.FixedVersion.ID
+			res.Status = statusOK
+			res.Message = fmt.Sprintf("sprint for issue %d was already set to %d, not updating", i.ID, i.FixedVersion.ID)
 		}
+		out.Record(res)
 	},
 }
 
 func checkError(err error) {
 	if err != nil {
-		fmt.Printf("%s\n", err.Error())
-		os.Exit(1)
+		log.Fatalf("Error: %s", err)
 	}
 }
 
 func checkError2(msg string, err error) {
 	if err != nil {
-		fmt.Printf("%s: %s\n", msg, err.Error())
-		os.Exit(1)
+		log.Fatalf("%s: %s", msg, err)
 	}
 }
 
@@ -391,6 +336,16 @@ var findAndAssociateIssuesCmd = &cobra.Command{
 	Use:   "find-and-associate",
 	Short: "Find all issue numbers to associate with a release, and associate them",
 	Long: "Find all issue numbers to associate with a release, and associate them.\n" +
+		"\nWith --plan, nothing is changed: the proposed changes are written to a file to\n" +
+		"be reviewed and executed with 'art redmine apply'.\n" +
+		"\nWithout --previous-release-tag, the version is taken from the release name\n" +
+		"(e.g. \"Arvados 2.7.2\"), and the previous release is the tag of the previous patch\n" +
+		"release on the same minor version (2.7.1), or for a new minor version, of the\n" +
+		"last release of the previous one. Release candidate tags (e.g. 3.0.0-rc1) are\n" +
+		"skipped.\n" +
+		"\nReleases that span several repositories are analyzed by adding the other\n" +
+		"repositories with --repo, e.g. --repo https://github.com/arvados/arvados-formula.git#2.7.1..2.7.2;\n" +
+		"the evidence for each issue then says which repository it was found in.\n" +
 		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
 		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
 	Run: func(cmd *cobra.Command, args []string) {
@@ -405,11 +360,9 @@ var findAndAssociateIssuesCmd = &cobra.Command{
 			log.Fatal(fmt.Errorf("Error retrieving new release: %s", err))
 			return
 		}
-		releaseID, err := cmd.Flags().GetInt("release")
-		if err != nil {
-			log.Fatal(fmt.Errorf("Error converting Redmine release ID to integer: %s", err))
-			return
-		}
+		r := newRedmineClient(cmd)
+		r.StrictNames()
+		releaseID := releaseFlag(cmd, r, namesProject(cmd, r))
 
 		autoSet, err := cmd.Flags().GetBool("auto-set")
 		if err != nil {
@@ -421,14 +374,30 @@ var findAndAssociateIssuesCmd = &cobra.Command{
 			log.Fatal(fmt.Errorf("Error getting skip-release-change value: %s", err))
 			return
 		}
-		arvRepo, err := cmd.Flags().GetString("source-repo")
+		cherryPicks, err := cmd.Flags().GetBool("cherry-picks")
+		if err != nil {
+			log.Fatal(fmt.Errorf("Error getting cherry-picks value: %s", err))
+			return
+		}
+		unassociateReverted, err := cmd.Flags().GetBool("unassociate-reverted")
 		if err != nil {
-			log.Fatal(fmt.Errorf("Error getting source-repo value: %s", err))
+			log.Fatal(fmt.Errorf("Error getting unassociate-reverted value: %s", err))
+			return
+		}
+		planPath, err := cmd.Flags().GetString("plan")
+		if err != nil {
+			log.Fatal(fmt.Errorf("Error getting plan value: %s", err))
+			return
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Fatal(fmt.Errorf("Error getting yes value: %s", err))
 			return
 		}
 
-		if len(previousReleaseTag) < 5 || len(previousReleaseTag) > 8 {
-			log.Fatal(fmt.Errorf("The previous-release-tag argument is of an unexpected format. Expecting a semantic version (e.g. 2.3.0)"))
+		if _, err := semver.NewVersion(previousReleaseTag); previousReleaseTag != "" && err != nil {
+			log.Fatal(fmt.Errorf("The previous-release-tag argument is of an unexpected format. Expecting a semantic version (e.g. 2.3.0): %s", err))
 			return
 		}
 		if len(newReleaseCommitHash) != 7 && len(newReleaseCommitHash) != 40 {
@@ -436,70 +405,24 @@ var findAndAssociateIssuesCmd = &cobra.Command{
 			return
 		}
 
-		// Clone the repo in memory
-
-		// our own arvados repo won't clone,
-		//arvRepo := "https://git.arvados.org/arvados.git"
-		//arvRepo := "https://github.com/arvados/arvados.git"
-
-		fmt.Println("Cloning " + arvRepo)
-		repo, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
-			URL: arvRepo,
-		})
-		checkError(err)
-		fmt.Println("... done")
-		fmt.Println()
-		start, err := repo.ResolveRevision(plumbing.Revision("refs/tags/" + previousReleaseTag))
-		checkError2("repo.ResolveRevision", err)
-		fmt.Printf("previous-release-tag: %s (%s)\n", previousReleaseTag, start)
-		fmt.Printf("new-release-commit: %s\n", newReleaseCommitHash)
-		fmt.Println()
-
-		// Build the exclusion list
-		seen := make(map[plumbing.Hash]bool)
-		excludeIter, err := repo.Log(&git.LogOptions{From: *start, Order: git.LogOrderCommitterTime})
-		checkError2("repo.Log", err)
-		excludeIter.ForEach(func(c *object.Commit) error {
-			seen[c.Hash] = true
-			return nil
-		})
-
-		// isValid returns merge commits that are not in the exclusion list
-		var isValid object.CommitFilter = func(commit *object.Commit) bool {
-			_, ok := seen[commit.Hash]
+		out := newPrinter(cmd)
+		defer out.Flush()
 
-			// use len(commit.ParentHashes) to only get merge commits
-			return !ok && len(commit.ParentHashes) >= 2
+		repo, repoName := openSourceRepo(cmd, out)
+		ranges := append([]repoRange{{Name: repoName, From: "refs/tags/" + previousReleaseTag, To: newReleaseCommitHash, repo: repo}}, openRepoRanges(cmd, out)...)
+		if previousReleaseTag == "" {
+			previousReleaseTag = inferPreviousReleaseTag(r, out, repo, releaseID, yes, "previous-release-tag")
+			ranges[0].From = "refs/tags/" + previousReleaseTag
 		}
+		out.Infof("\n")
+		out.Infof("previous-release-tag: %s\n", previousReleaseTag)
+		out.Infof("new-release-commit: %s\n", newReleaseCommitHash)
+		for _, rr := range ranges[1:] {
+			out.Infof("%s: %s..%s\n", rr.Name, rr.From, rr.To)
+		}
+		out.Infof("\n")
 
-		headCommit, err := repo.CommitObject(plumbing.NewHash(newReleaseCommitHash))
-		checkError2("repo.CommitObject", err)
-
-		iter := object.NewFilterCommitIter(headCommit, &isValid, nil)
-
-		issues := make(map[int]string)
-		re := regexp.MustCompile(`Merge branch `)
-		reNotMain := regexp.MustCompile(`Merge branch .(main|master)`)
-		reIssueRef := regexp.MustCompile(`(Closes|closes|Refs|refs|Fixes|fixes) #(\d+)`)
-		err = iter.ForEach(func(c *object.Commit) error {
-			// We have a git commit hook that requires an issue reference on merge commits
-			if re.MatchString(c.Message) && !reNotMain.MatchString(c.Message) {
-				m := reIssueRef.FindStringSubmatch(c.Message)
-				if len(m) == 3 {
-					i, err := strconv.Atoi(m[2])
-					if err != nil {
-						checkError(err)
-					}
-					issues[i] = fmt.Sprintf("%s: %s", c.Hash, c.Message)
-				}
-			}
-
-			if c.Hash == *start {
-				return storer.ErrStop
-			}
-			return nil
-		})
-		checkError(err)
+		issues, reverted := scanRanges(ranges, gitrelease.Options{CherryPicks: cherryPicks}, out)
 
 		// Sort the issue map keys
 		keys := make([]int, 0, len(issues))
@@ -508,72 +431,173 @@ var findAndAssociateIssuesCmd = &cobra.Command{
 		}
 		sort.Ints(keys)
 
-		r := redmine.NewClient(conf.Endpoint, conf.Apikey)
+		if planPath != "" {
+			plan := releasePlan{
+				Version:            releasePlanVersion,
+				CreatedAt:          time.Now().UTC(),
+				Endpoint:           conf.Endpoint,
+				Release:            redmine.ID{ID: releaseID},
+				PreviousReleaseTag: previousReleaseTag,
+				NewReleaseCommit:   newReleaseCommitHash,
+				Repos:              ranges[1:],
+				Changes:            []planChange{},
+			}
+			counts := make(map[string]int)
+			for _, k := range keys {
+				i, err := r.GetIssue(k)
+				if err != nil {
+					out.Record(actionResult{Object: "issue", ID: k, Status: statusError, Message: fmt.Sprintf("#%d: unable to retrieve issue: %s", k, err)})
+					continue
+				}
+				c := newPlanChange(i, releaseID, issues[k], reverted[k], unassociateReverted)
+				plan.Changes = append(plan.Changes, c)
+				counts[c.Action]++
+				out.Record(actionResult{
+					Object:  "issue",
+					ID:      c.Issue,
+					Subject: c.Subject,
+					Field:   "release",
+					From:    optionalReleaseID(c.CurrentRelease),
+					To:      releaseID,
+					Status:  c.Action,
+					Message: fmt.Sprintf("#%d - %s", c.Issue, c.Subject),
+					URL:     fmt.Sprintf("%s/issues/%d", conf.Endpoint, k),
+				})
+			}
+			err = writeReleasePlan(planPath, plan)
+			if err != nil {
+				log.Fatalf("Error writing plan: %s", err)
+			}
+			out.Infof("\nPlan written to %s: %d new, %d already set, %d conflicting, %d reverted.\n", planPath, counts[planNew], counts[planAlreadySet], counts[planConflicting], counts[planReverted])
+			out.Infof("Set \"apply\": true on the conflicting issues to move, then run 'art redmine apply %s'.\n", planPath)
+			return
+		}
 
 		for c, k := range keys {
-			fmt.Printf("%d (%d/%d): ", k, c+1, len(keys))
+			out.Infof("%d (%d/%d): ", k, c+1, len(keys))
 			// Look up the issue, see if it is already associated with the desired release
 
+			res := actionResult{Object: "issue", ID: k, Field: "release", To: releaseID, URL: fmt.Sprintf("%s/issues/%d", conf.Endpoint, k)}
 			i, err := r.GetIssue(k)
 			if err != nil {
-				fmt.Println()
-				fmt.Printf("[error] unable to retrieve issue: %s\n", err.Error())
-				fmt.Println("============================================")
+				out.Infof("\n")
+				res.Status = statusError
+				res.Message = fmt.Sprintf("unable to retrieve issue: %s", err)
+				out.Record(res)
+				out.Infof("============================================\n")
+				continue
+			}
+			res.Subject = i.Subject
+			out.Infof("%s\n  %s\n", i.Subject, strings.Join(issues[k], "\n  "))
+
+			if reverted[k] {
+				res.To = nil
+				res.From = optionalReleaseID(i.ReleaseRef())
+				res.Status = statusReverted
+				res.Message = "changes were reverted, not associating the issue with the release"
+				if cur := i.ReleaseRef(); cur != nil && cur.ID == releaseID {
+					res.Message = fmt.Sprintf("changes were reverted, but the release is set to %d", releaseID)
+					if unassociateReverted {
+						err = r.UpdateIssueFields(i.ID, map[string]interface{}{"release_id": ""})
+						if err != nil {
+							res.Status = statusError
+							res.Message = fmt.Sprintf("changes were reverted, but removing release %d failed: %s", releaseID, err)
+						} else {
+							res.Status = changedStatus(cmd)
+							res.Message = fmt.Sprintf("changes were reverted, release %d removed from issue %d", releaseID, i.ID)
+						}
+					}
+				}
+				out.Record(res)
+				out.Infof("============================================\n")
 				continue
 			}
-			fmt.Println(i.Subject)
-			fmt.Println(issues[k])
 
 			if i.Release != nil && i.Release["release"].ID != 0 {
+				res.From = i.Release["release"].ID
 				if i.Release["release"].ID == releaseID {
-					fmt.Printf("[ok] release is already set to %d, nothing to do\n", i.Release["release"].ID)
+					res.Status = statusOK
+					res.Message = fmt.Sprintf("release is already set to %d, nothing to do", i.Release["release"].ID)
 				} else if !skipReleaseChange {
-					fmt.Printf("%s/issues/%d\n", conf.Endpoint, k)
-					confirm := false
-					prompt := &survey.Confirm{
-						Message: fmt.Sprintf("release is set to %d, do you want to change it to %d ?", i.Release["release"].ID, releaseID),
-					}
-					err = survey.AskOne(prompt, &confirm)
+					out.Infof("%s\n", res.URL)
+					ok, err := confirm(out, fmt.Sprintf("release is set to %d, do you want to change it to %d ?", i.Release["release"].ID, releaseID))
 					if err != nil {
 						log.Fatal(err)
 					}
-					if confirm {
+					res.Status = statusSkipped
+					res.Message = fmt.Sprintf("release is set to %d, not changing it to %d", i.Release["release"].ID, releaseID)
+					if ok {
 						err = r.SetRelease(*i, releaseID)
 						if err != nil {
 							log.Fatal(err)
 						} else {
-							fmt.Printf("[changed] release for issue %d set to %d\n", i.ID, releaseID)
+							res.Status = changedStatus(cmd)
+							res.Message = fmt.Sprintf("release for issue %d set to %d", i.ID, releaseID)
 						}
 					}
 				} else {
-					fmt.Printf("[ok] release is set to %d, not changing it to %d\n", i.Release["release"].ID, releaseID)
+					res.Status = statusOK
+					res.Message = fmt.Sprintf("release is set to %d, not changing it to %d", i.Release["release"].ID, releaseID)
 				}
 			} else {
-				fmt.Printf("%s/issues/%d\n", conf.Endpoint, k)
-				confirm := false
+				out.Infof("%s\n", res.URL)
+				ok := false
 				if !autoSet {
-					prompt := &survey.Confirm{
-						Message: fmt.Sprintf("Release is not set, do you want to set it to %d ?", releaseID),
-					}
-					err = survey.AskOne(prompt, &confirm)
+					ok, err = confirm(out, fmt.Sprintf("Release is not set, do you want to set it to %d ?", releaseID))
 					if err != nil {
 						return
 					}
 				}
-				if confirm || autoSet {
+				res.Status = statusSkipped
+				res.Message = fmt.Sprintf("release is not set, not setting it to %d", releaseID)
+				if ok || autoSet {
 					err = r.SetRelease(*i, releaseID)
 					if err != nil {
 						log.Fatal(err)
 					} else {
-						fmt.Printf("[changed] release for issue %d set to %d\n", i.ID, releaseID)
+						res.Status = changedStatus(cmd)
+						res.Message = fmt.Sprintf("release for issue %d set to %d", i.ID, releaseID)
 					}
 				}
 			}
-			fmt.Println("============================================")
+			out.Record(res)
+			out.Infof("============================================\n")
 		}
 	},
 }
 
+var reReleaseVersion = regexp.MustCompile(`\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?`)
+
+// inferPreviousReleaseTag finds the tag of the release before the version in
+// the name of the Redmine release releaseID, and asks for confirmation
+// unless yes is set. flag names the option that sets the tag explicitly.
+func inferPreviousReleaseTag(r *redmine.Client, out *output.Printer, repo *git.Repository, releaseID int, yes bool, flag string) string {
+	release, err := r.GetRelease(releaseID)
+	if err != nil {
+		log.Fatalf("Error finding release with id %d: %s", releaseID, err)
+	}
+	version, err := semver.NewVersion(reReleaseVersion.FindString(release.Name))
+	if err != nil {
+		log.Fatalf("Unable to find a version number in the name of release '%s', use --%s", release.Name, flag)
+	}
+	tag, err := gitrelease.PreviousRelease(repo, version)
+	if err != nil {
+		log.Fatalf("Unable to find the previous release of %s, use --%s: %s", version, flag, err)
+	}
+	out.Infof("The release before '%s' is tagged %s\n", release.Name, tag.Name)
+	if yes {
+		return tag.Name
+	}
+	ok, err := confirm(out, fmt.Sprintf("Use %s as the previous release tag?", tag.Name))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !ok {
+		log.Fatalf("Aborted, use --%s to choose the previous release", flag)
+	}
+	return tag.Name
+}
+
 var createReleaseIssueCmd = &cobra.Command{
 	Use:   "create-release-issue",
 	Short: "Create a release ticket with numbered subtasks for all the steps on the release checklist",
@@ -589,18 +613,12 @@ var createReleaseIssueCmd = &cobra.Command{
 			return
 		}
 
-		versionID, err := cmd.Flags().GetInt("sprint")
-		if err != nil {
-			log.Fatal(fmt.Errorf("[error] can not convert Redmine sprint (version) ID to integer: %s", err))
-			return
-		}
-		projectName, err := cmd.Flags().GetString("project")
-		if err != nil {
-			log.Fatal(fmt.Errorf("[error] can not get Redmine project name: %s", err))
-			return
-		}
-
-		r := redmine.NewClient(conf.Endpoint, conf.Apikey)
+		r := newRedmineClient(cmd)
+		r.StrictNames()
+		projectName := projectFlag(cmd, r)
+		versionID := sprintFlag(cmd, r, projectName)
+		out := newPrinter(cmd)
+		defer out.Flush()
 
 		// Does this project exist?
 		project, err := r.GetProjectByName(projectName)
@@ -625,7 +643,14 @@ var createReleaseIssueCmd = &cobra.Command{
 			log.Fatal(fmt.Errorf("the release ticket status must be 'New'; the status of the release issue with id %d is '%s'", i.ID, v.Status))
 		}
 
-		fmt.Printf("[ok] the release ticket is '%s' with ID #%d (%s/issues/%d)\n", i.Subject, i.ID, conf.Endpoint, i.ID)
+		out.Record(actionResult{
+			Object:  "issue",
+			ID:      i.ID,
+			Subject: i.Subject,
+			Status:  statusOK,
+			Message: fmt.Sprintf("the release ticket is '%s' with ID #%d (%s/issues/%d)", i.Subject, i.ID, conf.Endpoint, i.ID),
+			URL:     fmt.Sprintf("%s/issues/%d", conf.Endpoint, i.ID),
+		})
 
 		// Get the list of subtasks from the "TASKS" file
 		tasks, err := os.Open("TASKS")
@@ -639,11 +664,18 @@ var createReleaseIssueCmd = &cobra.Command{
 		for scanner.Scan() {
 			task := scanner.Text()
 			taskIssue, err := r.FindOrCreateIssue(fmt.Sprintf("%d. %s", count, task), i.ID, v.ID, project.ID)
-			fmt.Printf("[ok] #%d: %d. %s\n", taskIssue.ID, count, task)
-			count++
 			if err != nil {
 				log.Fatal(fmt.Errorf("Error reading from file: %s", err))
 			}
+			out.Record(actionResult{
+				Object:  "issue",
+				ID:      taskIssue.ID,
+				Subject: taskIssue.Subject,
+				Status:  statusOK,
+				Message: fmt.Sprintf("#%d: %d. %s", taskIssue.ID, count, task),
+				URL:     fmt.Sprintf("%s/issues/%d", conf.Endpoint, taskIssue.ID),
+			})
+			count++
 		}
 
 		// Create the next release in Redmine
@@ -654,6 +686,7 @@ var createReleaseIssueCmd = &cobra.Command{
 		nextVersion := version.IncPatch()
 
 		var release *redmine.Release
+		releaseStatus := statusOK
 
 		release, err = r.FindReleaseByName(project.Name, "Arvados "+nextVersion.String())
 		if err != nil {
@@ -679,8 +712,16 @@ var createReleaseIssueCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("Unable to create release: %s", err)
 			}
-		}
-		fmt.Printf("[ok] the redmine release object for the next release is '%s' (%s/rb/release/%d)\n", release.Name, conf.Endpoint, release.ID)
+			releaseStatus = changedStatus(cmd)
+		}
+		out.Record(actionResult{
+			Object:  "release",
+			ID:      release.ID,
+			Subject: release.Name,
+			Status:  releaseStatus,
+			Message: fmt.Sprintf("the redmine release object for the next release is '%s' (%s/rb/release/%d)", release.Name, conf.Endpoint, release.ID),
+			URL:     fmt.Sprintf("%s/rb/release/%d", conf.Endpoint, release.ID),
+		})
 	},
 }
 
@@ -699,23 +740,17 @@ var getReleaseCmd = &cobra.Command{
 		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
 		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
 	Run: func(cmd *cobra.Command, args []string) {
-		releaseID, err := cmd.Flags().GetInt("release")
-		if err != nil {
-			fmt.Printf("Error converting Redmine release ID to integer: %s", err)
-			os.Exit(1)
-		}
-
-		r := redmine.NewClient(conf.Endpoint, conf.Apikey)
+		r := newRedmineClient(cmd)
+		releaseID := releaseFlag(cmd, r, namesProject(cmd, r))
 
 		release, err := r.GetRelease(releaseID)
 		if err != nil {
 			log.Fatalf("Error finding release with id %d: %s", releaseID, err)
 		}
-		releaseStr, err := json.MarshalIndent(release, "", "  ")
+		err = newPrinter(cmd).Object(release)
 		if err != nil {
 			log.Fatalf("Error decoding release with id %d: %s", releaseID, err)
 		}
-		fmt.Println(string(releaseStr))
 
 	},
 }
@@ -0,0 +1,219 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.arvados.org/arvados-dev.git/lib/gitrelease"
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+// Values of the actionResult Status field for audit findings
+const (
+	auditNotShipped   = "not-shipped"   // in the release, but no commit in the range
+	auditNoRelease    = "no-release"    // closed and in the range, but without release
+	auditOtherRelease = "other-release" // in the range, but in another release
+	auditNotFound     = "not-found"     // referenced in the range, but not in Redmine
+)
+
+func init() {
+	rootCmd.AddCommand(releaseCmd)
+
+	releaseAuditCmd.Flags().StringP("release", "r", "", "Redmine release ID or name")
+	err := releaseAuditCmd.MarkFlagRequired("release")
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	releaseAuditCmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
+	releaseAuditCmd.Flags().StringP("from", "f", "", "Tag of the previous release (default: the release tag before the version in the release name)")
+	releaseAuditCmd.Flags().StringP("to", "t", "", "Git commit (or branch or tag) of the new release")
+	err = releaseAuditCmd.MarkFlagRequired("to")
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	releaseAuditCmd.Flags().BoolP("yes", "y", false, "Use the inferred previous release tag without asking for confirmation")
+	releaseAuditCmd.Flags().BoolP("cherry-picks", "", false, "Also look for fixes cherry-picked with 'git cherry-pick -x' (e.g. on X.Y-staging branches)")
+	addRepoFlags(releaseAuditCmd)
+	addMultiRepoFlags(releaseAuditCmd)
+	releaseCmd.AddCommand(releaseAuditCmd)
+}
+
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Check Redmine releases against the git history",
+	Long: "Check Redmine releases against the git history.\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+}
+
+var releaseAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Find the issues of a release that were not shipped, and the shipped issues that are not in the release",
+	Long: "Find the issues of a release that were not shipped, and the shipped issues that are not in the release.\n" +
+		"\nThis is the reverse of 'art redmine issues find-and-associate': the issues\n" +
+		"associated with the release are compared with the issues referenced by the\n" +
+		"commits between --from and --to. The findings are:\n" +
+		"\n  not-shipped    the issue is in the release, but no commit in the range refers\n" +
+		"                 to it, or its changes were reverted\n" +
+		"  no-release     the issue is closed and referenced in the range, but has no release\n" +
+		"  other-release  the issue is referenced in the range, but is in another release\n" +
+		"  not-found      the issue referenced in the range does not exist in Redmine\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Run: func(cmd *cobra.Command, args []string) {
+		from, err := cmd.Flags().GetString("from")
+		if err != nil {
+			log.Fatalf("Error getting the from parameter: %s", err)
+		}
+		to, err := cmd.Flags().GetString("to")
+		if err != nil {
+			log.Fatalf("Error getting the to parameter: %s", err)
+		}
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Fatalf("Error getting the yes parameter: %s", err)
+		}
+		cherryPicks, err := cmd.Flags().GetBool("cherry-picks")
+		if err != nil {
+			log.Fatalf("Error getting the cherry-picks parameter: %s", err)
+		}
+		r := newRedmineClient(cmd)
+		releaseID := releaseFlag(cmd, r, namesProject(cmd, r))
+
+		out := newPrinter(cmd)
+		defer out.Flush()
+
+		repo, repoName := openSourceRepo(cmd, out)
+		if from == "" {
+			from = inferPreviousReleaseTag(r, out, repo, releaseID, yes, "from")
+		}
+		ranges := append([]repoRange{{Name: repoName, From: from, To: to, repo: repo}}, openRepoRanges(cmd, out)...)
+		for _, rr := range ranges {
+			out.Infof("%s: %s..%s\n", rr.Name, rr.From, rr.To)
+		}
+		out.Infof("\n")
+		evidence, reverted := scanRanges(ranges, gitrelease.Options{CherryPicks: cherryPicks}, out)
+
+		statuses, err := r.IssueStatuses()
+		if err != nil {
+			log.Fatalf("Error getting the issue statuses: %s", err)
+		}
+		closed := make(map[int]bool)
+		for _, s := range statuses {
+			closed[s.ID] = s.IsClosed
+		}
+
+		claimed, err := r.FilteredIssues(&redmine.IssueFilter{ReleaseID: strconv.Itoa(releaseID), StatusID: "*"})
+		if err != nil {
+			log.Fatalf("Error getting the issues of release %d: %s", releaseID, err)
+		}
+		ids := make([]int, 0, len(evidence))
+		for id := range evidence {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		shipped, err := issuesByID(r, ids)
+		if err != nil {
+			log.Fatalf("Error getting the issues referenced in the range: %s", err)
+		}
+
+		var findings []actionResult
+		finding := func(i *redmine.Issue, status, message string) {
+			res := actionResult{
+				Object:  "issue",
+				ID:      i.ID,
+				Subject: i.Subject,
+				Field:   "release",
+				Status:  status,
+				Message: fmt.Sprintf("#%d: %s", i.ID, message),
+				URL:     fmt.Sprintf("%s/issues/%d", conf.Endpoint, i.ID),
+			}
+			if rel := i.ReleaseRef(); rel != nil {
+				res.From = rel.ID
+			}
+			findings = append(findings, res)
+		}
+		for k := range claimed {
+			i := &claimed[k]
+			switch {
+			case evidence[i.ID] == nil:
+				finding(i, auditNotShipped, "no commit in the range refers to the issue")
+			case reverted[i.ID]:
+				finding(i, auditNotShipped, "the changes for the issue were reverted")
+			}
+		}
+		for _, id := range ids {
+			i, ok := shipped[id]
+			switch {
+			case !ok:
+				findings = append(findings, actionResult{
+					Object:  "issue",
+					ID:      id,
+					Status:  auditNotFound,
+					Message: fmt.Sprintf("#%d: issue not found, referenced by %s", id, evidence[id][0]),
+				})
+			case reverted[id]:
+			case i.ReleaseRef() == nil:
+				if i.Status != nil && closed[i.Status.ID] {
+					finding(i, auditNoRelease, fmt.Sprintf("issue is %s but has no release", i.Status.Name))
+				}
+			case i.ReleaseRef().ID != releaseID:
+				finding(i, auditOtherRelease, fmt.Sprintf("issue is in release '%s'", i.ReleaseRef().Name))
+			}
+		}
+		sort.SliceStable(findings, func(a, b int) bool {
+			if findings[a].Status != findings[b].Status {
+				return auditOrder[findings[a].Status] < auditOrder[findings[b].Status]
+			}
+			return findings[a].ID < findings[b].ID
+		})
+		counts := make(map[string]int)
+		for _, f := range findings {
+			counts[f.Status]++
+			out.Record(f)
+		}
+		out.Infof("\n%d issues in the release, %d referenced in the range: %d not shipped, %d closed without release, %d in another release, %d not found.\n",
+			len(claimed), len(ids), counts[auditNotShipped], counts[auditNoRelease], counts[auditOtherRelease], counts[auditNotFound])
+	},
+}
+
+// auditOrder is the order in which the findings of an audit are listed
+var auditOrder = map[string]int{
+	auditNotShipped:   0,
+	auditNoRelease:    1,
+	auditOtherRelease: 2,
+	auditNotFound:     3,
+}
+
+// issuesByID fetches the issues with the given IDs, whatever their status,
+// a hundred at a time. Issues that do not exist (or are not visible) are
+// missing from the result.
+func issuesByID(r *redmine.Client, ids []int) (map[int]*redmine.Issue, error) {
+	issues := make(map[int]*redmine.Issue)
+	for start := 0; start < len(ids); start += 100 {
+		end := start + 100
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var batch []string
+		for _, id := range ids[start:end] {
+			batch = append(batch, strconv.Itoa(id))
+		}
+		err := r.EachIssue(&redmine.IssueFilter{IssueID: strings.Join(batch, ","), StatusID: "*"}, func(i redmine.Issue) error {
+			issues[i.ID] = &i
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return issues, nil
+}
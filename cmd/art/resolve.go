@@ -0,0 +1,85 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+// projectFlag returns the identifier of the project given by name,
+// identifier or ID in the --project flag, or in the config profile.
+func projectFlag(cmd *cobra.Command, rm *redmine.Client) string {
+	name := stringFlagOrConfig(cmd, "project", conf.Project)
+	p, err := rm.ResolveProject(name)
+	if err != nil {
+		log.Fatalf("Error: --project: %s", err)
+	}
+	return p
+}
+
+// namesProject returns the identifier of the project in which the names
+// given to the other flags are looked up: the one in the --project flag, or
+// in the config profile. Unlike projectFlag, it returns "" if neither is set,
+// so that IDs can be used without a project.
+func namesProject(cmd *cobra.Command, rm *redmine.Client) string {
+	name, err := cmd.Flags().GetString("project")
+	if err != nil {
+		log.Fatalf("Error getting the project parameter: %s", err)
+	}
+	if !cmd.Flags().Changed("project") {
+		name = conf.Project
+	}
+	if name == "" {
+		return ""
+	}
+	p, err := rm.ResolveProject(name)
+	if err != nil {
+		log.Fatalf("Error: --project: %s", err)
+	}
+	return p
+}
+
+// idFlag returns the ID of the object given by ID or name in the named flag,
+// looking up names with resolve. It returns 0 if the flag is not set.
+func idFlag(cmd *cobra.Command, name string, resolve func(string) (string, error)) int {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil {
+		log.Fatalf("Error getting the %s parameter: %s", name, err)
+	}
+	if value == "" {
+		return 0
+	}
+	id, err := resolve(value)
+	if err != nil {
+		log.Fatalf("Error: --%s: %s", name, err)
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		log.Fatalf("Error: --%s: '%s' is not a single ID", name, id)
+	}
+	return n
+}
+
+// releaseFlag returns the ID of the release given by ID or name in the
+// --release flag. Names are looked up in project.
+func releaseFlag(cmd *cobra.Command, rm *redmine.Client, project string) int {
+	return idFlag(cmd, "release", func(s string) (string, error) { return rm.ResolveRelease(project, s) })
+}
+
+// sprintFlag returns the ID of the sprint given by ID or name in the
+// --sprint flag. Names are looked up in project.
+func sprintFlag(cmd *cobra.Command, rm *redmine.Client, project string) int {
+	return idFlag(cmd, "sprint", func(s string) (string, error) { return rm.ResolveSprint(project, s) })
+}
+
+// issueFlag returns the ID of the issue given by ID or subject in the
+// --issue flag. Subjects are looked up in project.
+func issueFlag(cmd *cobra.Command, rm *redmine.Client, project string) int {
+	return idFlag(cmd, "issue", func(s string) (string, error) { return rm.ResolveIssue(project, s) })
+}
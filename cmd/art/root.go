@@ -6,39 +6,96 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
+	"git.arvados.org/arvados-dev.git/lib/config"
+	"git.arvados.org/arvados-dev.git/lib/redmine"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
-	conf config
+	conf config.Config
 )
 
-type config struct {
-	Endpoint string `json:"endpoint"` // https://dev-dev.arvados.org
-	Apikey   string `json:"apikey"`   // abcde...
+// loadConfig loads the profile selected with the --config and --profile flags
+func loadConfig() {
+	path, err := rootCmd.PersistentFlags().GetString("config")
+	if err != nil {
+		log.Fatalf("Error getting the config parameter: %s", err)
+	}
+	profile, err := rootCmd.PersistentFlags().GetString("profile")
+	if err != nil {
+		log.Fatalf("Error getting the profile parameter: %s", err)
+	}
+	conf, err = config.Load(path, profile)
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
 }
 
-func loadConfig() config {
-	var c config
-
-	Viper := viper.New()
-	Viper.SetEnvPrefix("redmine") // will be uppercased automatically
-	Viper.BindEnv("endpoint")
-	Viper.BindEnv("apikey")
-
-	c.Endpoint = Viper.GetString("endpoint")
-	c.Apikey = Viper.GetString("apikey")
-
-	return c
+// stringFlagOrConfig returns the value of the named flag if it was given on
+// the command line, and the value from the config profile otherwise. It
+// exits with an error if neither is set.
+func stringFlagOrConfig(cmd *cobra.Command, name, configValue string) string {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil {
+		log.Fatalf("Error getting the %s parameter: %s", name, err)
+	}
+	if !cmd.Flags().Changed(name) && configValue != "" {
+		value = configValue
+	}
+	if value == "" {
+		log.Fatalf("Error: the --%s flag must be given, or %s must be set in the config profile", name, name)
+	}
+	return value
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("output", "o", "", "Output format. Empty for human-readable, 'json' or 'json-line'")
+	cobra.OnInitialize(loadConfig)
+	rootCmd.PersistentFlags().StringP("config", "", "", "Config file (default "+config.DefaultPath()+")")
+	rootCmd.PersistentFlags().StringP("profile", "P", "", "Config profile to use (default from $ARVADOS_DEV_PROFILE or default-profile in the config file)")
+	rootCmd.PersistentFlags().StringP("output", "o", "", "Output format. Empty for human-readable, 'json', 'json-line', 'table', 'csv', 'markdown' or 'yaml'")
+	rootCmd.PersistentFlags().StringSliceP("columns", "", nil, "Comma separated list of the fields to output (default all)")
 	rootCmd.PersistentFlags().BoolP("help", "h", false, "Print help")
 	rootCmd.PersistentFlags().BoolP("debug", "d", false, "Print debug output")
+	rootCmd.PersistentFlags().BoolP("dry-run", "", false, "Only report what will happen without making any change")
+	rootCmd.PersistentFlags().StringP("audit-log", "", redmine.DefaultAuditLogPath(), "File to record all changes made to Redmine in (empty to disable)")
+}
+
+// auditLog is shared by all redmine clients, so that every change made by
+// one invocation of art is recorded with the same run ID.
+var auditLog *redmine.AuditLog
+
+// newRedmineClient returns a redmine client for the configured endpoint. When
+// the --dry-run flag is set, mutating requests are printed to stderr instead
+// of being sent. Otherwise, changes are recorded in the audit log. With
+// --debug, all requests are logged to stderr.
+func newRedmineClient(cmd *cobra.Command) *redmine.Client {
+	err := conf.ResolveApikey()
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	c := redmine.NewClient(conf.Endpoint, string(conf.Apikey))
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err == nil && dryRun {
+		c.DryRun(os.Stderr)
+	}
+	debug, err := cmd.Flags().GetBool("debug")
+	if err == nil && debug {
+		fmt.Fprintf(os.Stderr, "[debug] profile '%s' from %s, endpoint %s, API key %s from %s\n", conf.ProfileName, conf.Path, conf.Endpoint, conf.Apikey, conf.ApikeySource)
+		c.Debug(os.Stderr)
+	}
+	auditPath, err := cmd.Flags().GetString("audit-log")
+	if err == nil && auditPath != "" {
+		if auditLog == nil {
+			auditLog = redmine.NewAuditLog(auditPath)
+			auditLog.Command = strings.Join(os.Args, " ")
+		}
+		c.SetAuditLog(auditLog)
+	}
+	return c
 }
 
 var rootCmd = &cobra.Command{
@@ -47,14 +104,18 @@ var rootCmd = &cobra.Command{
 	Long: `
 art (Arvados Release Tool) supports the Arvados development process
 
-https://git.arvados.org/arvados-dev.git/cmd/art`,
+https://git.arvados.org/arvados-dev.git/cmd/art
+
+Settings are read from a profile in the config file; see --config and --profile.
+The REDMINE_ENDPOINT, REDMINE_APIKEY and REDMINE_PROJECT environment variables
+override the values in the profile.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		return nil
 	},
 }
 
 func Execute() {
-	conf = loadConfig()
+	registerCompletions(rootCmd)
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -0,0 +1,220 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"git.arvados.org/arvados-dev.git/lib/output"
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	undoCmd.Flags().StringP("run", "", "", "ID of the run to revert")
+	undoCmd.Flags().BoolP("list", "l", false, "List the runs recorded in the audit log")
+	undoCmd.Flags().BoolP("force", "f", false, "Revert fields even if they were changed again after the run")
+	rootCmd.AddCommand(undoCmd)
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Revert the changes made to Redmine by an earlier run of art",
+	Long: "Revert the changes made to Redmine by an earlier run of art.\n" +
+		"\nEvery change art makes to Redmine is recorded in the audit log (see --audit-log)," +
+		"\ntogether with the ID of the run that made it. Use --list to find the run ID." +
+		"\nFields that were changed again after the run are left alone unless --force is given." +
+		"\nIssues and releases created by the run are not deleted. A run can only be reverted" +
+		"\non the Redmine server it was made on." +
+		"\n\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+	Run: func(cmd *cobra.Command, args []string) {
+		auditPath, err := cmd.Flags().GetString("audit-log")
+		if err != nil {
+			log.Fatalf("Error getting the audit-log parameter: %s", err)
+		}
+		list, err := cmd.Flags().GetBool("list")
+		if err != nil {
+			log.Fatalf("Error getting the list parameter: %s", err)
+		}
+		runID, err := cmd.Flags().GetString("run")
+		if err != nil {
+			log.Fatalf("Error getting the run parameter: %s", err)
+		}
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			log.Fatalf("Error getting the force parameter: %s", err)
+		}
+		if auditPath == "" {
+			log.Fatalf("Error: no audit log configured")
+		}
+
+		entries, err := redmine.ReadAuditLog(auditPath)
+		if err != nil {
+			log.Fatalf("Error reading audit log: %s", err)
+		}
+
+		out := newPrinter(cmd)
+		defer out.Flush()
+		if list || runID == "" {
+			listRuns(out, entries)
+			return
+		}
+
+		var run []redmine.AuditEntry
+		for _, e := range entries {
+			if e.Run == runID {
+				run = append(run, e)
+			}
+		}
+		if len(run) == 0 {
+			log.Fatalf("Error: run %s not found in %s", runID, auditPath)
+		}
+
+		checkRedmineConfig(cmd)
+		for _, e := range run {
+			if e.Endpoint != conf.Endpoint {
+				endpoint := e.Endpoint
+				if endpoint == "" {
+					endpoint = "an unknown server"
+				}
+				log.Fatalf("Error: run %s was made on %s, not %s", runID, endpoint, conf.Endpoint)
+			}
+		}
+		rm := newRedmineClient(cmd)
+		changed := changedStatus(cmd)
+		errCount := 0
+		// Revert the most recent change first, so that an issue updated
+		// several times in the run ends up with its original values.
+		for i := len(run) - 1; i >= 0; i-- {
+			e := run[i]
+			if e.Action != "update" || e.Object != "issue" {
+				out.Record(actionResult{
+					Object:  e.Object,
+					ID:      e.ObjectID,
+					Status:  statusSkipped,
+					Message: fmt.Sprintf("%s of %s %d can not be reverted", e.Action, e.Object, e.ObjectID),
+				})
+				continue
+			}
+			issue, err := rm.GetIssue(e.ObjectID)
+			if err != nil {
+				out.Record(actionResult{
+					Object:  e.Object,
+					ID:      e.ObjectID,
+					Status:  statusError,
+					Message: fmt.Sprintf("unable to retrieve issue %d: %s", e.ObjectID, err),
+				})
+				errCount++
+				continue
+			}
+			current := redmine.IssueFields(*issue)
+			fields := make(map[string]interface{})
+			for _, c := range e.Changes {
+				if !force && !redmine.SameValue(current[c.Field], c.After) {
+					out.Record(actionResult{
+						Object:  e.Object,
+						ID:      e.ObjectID,
+						Subject: issue.Subject,
+						Field:   c.Field,
+						From:    current[c.Field],
+						To:      c.Before,
+						Status:  statusSkipped,
+						Message: fmt.Sprintf("%s for issue %d was changed to %v after the run", c.Field, e.ObjectID, current[c.Field]),
+					})
+					continue
+				}
+				if c.Before == nil {
+					fields[c.Field] = ""
+				} else {
+					fields[c.Field] = c.Before
+				}
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			err = rm.UpdateIssueFields(e.ObjectID, fields)
+			if err != nil {
+				out.Record(actionResult{
+					Object:  e.Object,
+					ID:      e.ObjectID,
+					Subject: issue.Subject,
+					Status:  statusError,
+					Message: fmt.Sprintf("unable to revert issue %d: %s", e.ObjectID, err),
+				})
+				errCount++
+				continue
+			}
+			for _, c := range e.Changes {
+				v, ok := fields[c.Field]
+				if !ok {
+					continue
+				}
+				res := actionResult{
+					Object:  e.Object,
+					ID:      e.ObjectID,
+					Subject: issue.Subject,
+					Field:   c.Field,
+					From:    c.After,
+					To:      c.Before,
+					Status:  changed,
+					Message: fmt.Sprintf("%s for issue %d reverted to %v", c.Field, e.ObjectID, v),
+				}
+				if v == "" {
+					res.Message = fmt.Sprintf("%s for issue %d cleared", c.Field, e.ObjectID)
+				}
+				out.Record(res)
+			}
+		}
+		if errCount > 0 {
+			out.Flush()
+			log.Fatalf("Warning: %d error(s) found.", errCount)
+		}
+	},
+}
+
+// runSummary describes one run recorded in the audit log
+type runSummary struct {
+	Run      string    `json:"run"`
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Endpoint string    `json:"endpoint"`
+	Changes  int       `json:"changes"`
+	Command  string    `json:"command"`
+}
+
+func (r runSummary) String() string {
+	return fmt.Sprintf("%s  %s  %-12s %3d change(s)  %s", r.Run, r.Time.Local().Format("2006-01-02 15:04"), r.User, r.Changes, r.Command)
+}
+
+// listRuns prints one record per run in the audit log
+func listRuns(out *output.Printer, entries []redmine.AuditEntry) {
+	var runs []string
+	byRun := make(map[string][]redmine.AuditEntry)
+	for _, e := range entries {
+		if _, ok := byRun[e.Run]; !ok {
+			runs = append(runs, e.Run)
+		}
+		byRun[e.Run] = append(byRun[e.Run], e)
+	}
+	if len(runs) == 0 {
+		out.Infof("The audit log is empty\n")
+		return
+	}
+	for _, r := range runs {
+		first := byRun[r][0]
+		out.Record(runSummary{
+			Run:      r,
+			Time:     first.Time,
+			User:     first.User,
+			Endpoint: first.Endpoint,
+			Changes:  len(byRun[r]),
+			Command:  strings.TrimSpace(first.Command),
+		})
+	}
+}
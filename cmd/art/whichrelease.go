@@ -0,0 +1,200 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"git.arvados.org/arvados-dev.git/lib/gitrelease"
+	"github.com/Masterminds/semver"
+	"github.com/spf13/cobra"
+)
+
+// Values of the issueReleases Check field
+const (
+	checkOK         = "ok"          // the Redmine release is a release that shipped the changes
+	checkNoRelease  = "no-release"  // the changes shipped, but the issue has no release
+	checkMismatch   = "mismatch"    // the Redmine release did not ship the changes
+	checkUnreleased = "unreleased"  // the Redmine release is not tagged yet
+	checkNotShipped = "not-shipped" // no release tag contains the changes
+)
+
+func init() {
+	issuesCmd.AddCommand(newWhichReleaseCmd())
+	// Also available as 'art issues which-release', since it is more about
+	// the git history than about Redmine
+	topIssuesCmd.AddCommand(newWhichReleaseCmd())
+	rootCmd.AddCommand(topIssuesCmd)
+}
+
+var topIssuesCmd = &cobra.Command{
+	Use:   "issues",
+	Short: "Analyze the changes for Redmine issues in the git history",
+	Long: "Analyze the changes for Redmine issues in the git history.\n" +
+		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+}
+
+// issueReleases tells which releases shipped the changes for an issue
+type issueReleases struct {
+	ID      int          `json:"id"`
+	Subject string       `json:"subject"`
+	Release string       `json:"release"` // in Redmine
+	Commits []string     `json:"commits"`
+	Shipped []shippedTag `json:"shipped"`
+	Check   string       `json:"check"`
+	Message string       `json:"message"`
+}
+
+// shippedTag is the first tag of a release line that contains the changes
+type shippedTag struct {
+	Line string `json:"line"`
+	Tag  string `json:"tag"`
+}
+
+func (d issueReleases) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#%d: %s\n", d.ID, d.Subject)
+	if d.Release != "" {
+		fmt.Fprintf(&b, "Release: %s\n", d.Release)
+	} else {
+		fmt.Fprintf(&b, "Release: -\n")
+	}
+	if len(d.Commits) > 0 {
+		fmt.Fprintf(&b, "\nCommits:\n")
+		for _, c := range d.Commits {
+			fmt.Fprintf(&b, "  %s\n", c)
+		}
+	}
+	if len(d.Shipped) > 0 {
+		fmt.Fprintf(&b, "\nFirst shipped in:\n")
+		for _, s := range d.Shipped {
+			fmt.Fprintf(&b, "  %-6s %s\n", s.Line+".x", s.Tag)
+		}
+	}
+	fmt.Fprintf(&b, "\n[%s] %s", d.Check, d.Message)
+	return b.String()
+}
+
+// newWhichReleaseCmd returns the which-release command, which is registered
+// in two places
+func newWhichReleaseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "which-release [issue ID or subject]",
+		Short: "Find the releases that shipped the changes for an issue",
+		Long: "Find the releases that shipped the changes for an issue.\n" +
+			"\nThe merges and cherry-picks that refer to the issue are looked up in all the\n" +
+			"branches of the source repository, and for each release line (X.Y), the first\n" +
+			"tag that contains one of them (and not its revert) is reported. The result is\n" +
+			"checked against the release of the issue in Redmine.\n" +
+			"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
+			"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+		Args: cobra.MaximumNArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) > 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completionFunc("issue", completeIssues)(cmd, args, toComplete)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			rm := newRedmineClient(cmd)
+			if len(args) == 1 {
+				err := cmd.Flags().Set("issue", strings.TrimPrefix(args[0], "#"))
+				if err != nil {
+					log.Fatalf("Error: %s", err)
+				}
+			}
+			issueID := issueFlag(cmd, rm, namesProject(cmd, rm))
+			if issueID == 0 {
+				log.Fatalf("Error: an issue ID is required")
+			}
+			i, err := rm.GetIssue(issueID)
+			if err != nil {
+				log.Fatalf("Error retrieving issue %d: %s", issueID, err)
+			}
+
+			out := newPrinter(cmd)
+			repo, _ := openSourceRepo(cmd, out)
+
+			refs, err := gitrelease.Find(repo, issueID, gitrelease.Options{CherryPicks: true})
+			if err != nil {
+				log.Fatalf("Error analyzing the repository: %s", err)
+			}
+			first, err := gitrelease.FirstReleases(repo, refs)
+			if err != nil {
+				log.Fatalf("Error analyzing the repository: %s", err)
+			}
+
+			d := issueReleases{ID: i.ID, Subject: i.Subject, Commits: []string{}, Shipped: []shippedTag{}}
+			for _, r := range refs {
+				d.Commits = append(d.Commits, r.String())
+			}
+			for _, t := range first {
+				d.Shipped = append(d.Shipped, shippedTag{Line: fmt.Sprintf("%d.%d", t.Version.Major(), t.Version.Minor()), Tag: t.Name})
+			}
+			if rel := i.ReleaseRef(); rel != nil {
+				d.Release = rel.Name
+			}
+			tags, err := gitrelease.Tags(repo)
+			if err != nil {
+				log.Fatalf("Error analyzing the repository: %s", err)
+			}
+			d.Check, d.Message = checkIssueRelease(d.Release, first, tags)
+			err = out.Object(d)
+			if err != nil {
+				log.Fatalf("Error: %s", err)
+			}
+		},
+	}
+	cmd.Flags().StringP("issue", "i", "", "Redmine issue ID or subject")
+	cmd.Flags().StringP("project", "p", "", "Redmine project identifier, name or ID (default from the config profile)")
+	addRepoFlags(cmd)
+	return cmd
+}
+
+// checkIssueRelease compares the Redmine release of an issue with the first
+// tags that shipped its changes, given all the release tags
+func checkIssueRelease(release string, first, tags []gitrelease.Tag) (string, string) {
+	if release == "" {
+		if len(first) == 0 {
+			return checkNotShipped, "no release tag contains the changes for the issue"
+		}
+		return checkNoRelease, fmt.Sprintf("the changes first shipped in %s, but the issue has no release", first[0].Name)
+	}
+	version, err := semver.NewVersion(reReleaseVersion.FindString(release))
+	if err != nil {
+		return checkMismatch, fmt.Sprintf("unable to find a version number in the name of release '%s'", release)
+	}
+	for _, t := range first {
+		if shippedIn(t, version) {
+			return checkOK, fmt.Sprintf("the changes first shipped in %s, which matches release '%s'", t.Name, release)
+		}
+	}
+	tagged := false
+	for _, t := range tags {
+		tagged = tagged || t.Version.Equal(version)
+	}
+	switch {
+	case !tagged && len(first) == 0:
+		return checkUnreleased, fmt.Sprintf("release '%s' is not tagged yet", release)
+	case !tagged:
+		return checkUnreleased, fmt.Sprintf("release '%s' is not tagged yet, but the changes already shipped in %s", release, first[0].Name)
+	case len(first) == 0:
+		return checkNotShipped, fmt.Sprintf("the issue is in release '%s', but no release tag contains its changes", release)
+	}
+	return checkMismatch, fmt.Sprintf("the issue is in release '%s', but the changes first shipped in %s", release, first[0].Name)
+}
+
+// shippedIn tells whether tag is the release version, or one of its release
+// candidates: the first tag of a line that contains the changes can be
+// 3.0.0-rc1, and the changes are then shipped in 3.0.0 too.
+func shippedIn(tag gitrelease.Tag, version *semver.Version) bool {
+	if version.Prerelease() != "" {
+		return tag.Version.Equal(version)
+	}
+	return tag.Version.Major() == version.Major() && tag.Version.Minor() == version.Minor() && tag.Version.Patch() == version.Patch()
+}
@@ -0,0 +1,71 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"testing"
+
+	"git.arvados.org/arvados-dev.git/lib/gitrelease"
+	"github.com/Masterminds/semver"
+)
+
+func testTags(names ...string) []gitrelease.Tag {
+	var tags []gitrelease.Tag
+	for _, n := range names {
+		tags = append(tags, gitrelease.Tag{Name: n, Version: semver.MustParse(n)})
+	}
+	return tags
+}
+
+func TestShippedIn(t *testing.T) {
+	for _, tc := range []struct {
+		tag      string
+		version  string
+		expected bool
+	}{
+		{"2.7.1", "2.7.1", true},
+		{"v2.7.1", "2.7.1", true},
+		{"2.7.1", "2.7.2", false},
+		{"2.7.1", "2.8.1", false},
+		{"3.0.0-rc1", "3.0.0", true},
+		{"3.0.0-rc2", "3.0.0-rc2", true},
+		{"3.0.0-rc1", "3.0.0-rc2", false},
+		{"3.0.0", "3.0.0-rc1", false},
+		{"3.0.1-rc1", "3.0.0", false},
+	} {
+		tag := testTags(tc.tag)[0]
+		if got := shippedIn(tag, semver.MustParse(tc.version)); got != tc.expected {
+			t.Errorf("%s in %s: expected %v, got %v", tc.tag, tc.version, tc.expected, got)
+		}
+	}
+}
+
+func TestCheckIssueRelease(t *testing.T) {
+	tags := testTags("2.6.3", "2.7.0", "2.7.1", "3.0.0-rc1", "3.0.0")
+	for _, tc := range []struct {
+		release  string
+		first    []gitrelease.Tag
+		expected string
+		message  string
+	}{
+		{"", nil, checkNotShipped, "no release tag contains the changes for the issue"},
+		{"", testTags("2.7.1"), checkNoRelease, "the changes first shipped in 2.7.1, but the issue has no release"},
+		{"Arvados 2.7.1", testTags("2.7.1"), checkOK, "the changes first shipped in 2.7.1, which matches release 'Arvados 2.7.1'"},
+		{"Arvados 2.6.3", testTags("2.6.3", "2.7.1"), checkOK, "the changes first shipped in 2.6.3, which matches release 'Arvados 2.6.3'"},
+		{"Arvados 2.7.1", testTags("2.6.3", "2.7.1"), checkOK, "the changes first shipped in 2.7.1, which matches release 'Arvados 2.7.1'"},
+		{"Arvados 3.0.0", testTags("3.0.0-rc1"), checkOK, "the changes first shipped in 3.0.0-rc1, which matches release 'Arvados 3.0.0'"},
+		{"Arvados 3.0.0-rc1", testTags("3.0.0-rc1"), checkOK, "the changes first shipped in 3.0.0-rc1, which matches release 'Arvados 3.0.0-rc1'"},
+		{"Arvados 2.7.0", testTags("2.7.1"), checkMismatch, "the issue is in release 'Arvados 2.7.0', but the changes first shipped in 2.7.1"},
+		{"Arvados 2.7.0", nil, checkNotShipped, "the issue is in release 'Arvados 2.7.0', but no release tag contains its changes"},
+		{"Arvados 2.7.2", nil, checkUnreleased, "release 'Arvados 2.7.2' is not tagged yet"},
+		{"Arvados 2.7.2", testTags("2.7.1"), checkUnreleased, "release 'Arvados 2.7.2' is not tagged yet, but the changes already shipped in 2.7.1"},
+		{"Arvados Future", testTags("2.7.1"), checkMismatch, "unable to find a version number in the name of release 'Arvados Future'"},
+	} {
+		check, message := checkIssueRelease(tc.release, tc.first, tags)
+		if check != tc.expected || message != tc.message {
+			t.Errorf("%q %v: expected %s %q, got %s %q", tc.release, tc.first, tc.expected, tc.message, check, message)
+		}
+	}
+}
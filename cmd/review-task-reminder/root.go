@@ -16,10 +16,10 @@ import (
 	"text/template"
 	"time"
 
+	"git.arvados.org/arvados-dev.git/lib/config"
 	"git.arvados.org/arvados-dev.git/lib/redmine"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 //go:embed emailTemplate.txt
@@ -51,39 +51,34 @@ type Report struct {
 }
 
 var (
-	conf config
+	conf config.Config
 )
 
-type config struct {
-	Endpoint string `json:"endpoint"` // https://dev-dev.arvados.org
-	Apikey   string `json:"apikey"`   // abcde...
-}
-
-func loadConfig() config {
-	var c config
-
-	Viper := viper.New()
-	Viper.SetEnvPrefix("redmine") // will be uppercased automatically
-	Viper.BindEnv("endpoint")
-	Viper.BindEnv("apikey")
-
-	c.Endpoint = Viper.GetString("endpoint")
-	c.Apikey = Viper.GetString("apikey")
-
-	return c
+// loadConfig loads the profile selected with the --config and --profile flags
+func loadConfig() {
+	path, err := rootCmd.PersistentFlags().GetString("config")
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	profile, err := rootCmd.PersistentFlags().GetString("profile")
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+	conf, err = config.Load(path, profile)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
 }
 
 func init() {
+	cobra.OnInitialize(loadConfig)
+	rootCmd.PersistentFlags().StringP("config", "", "", "Config file (default "+config.DefaultPath()+")")
+	rootCmd.PersistentFlags().StringP("profile", "P", "", "Config profile to use (default from $ARVADOS_DEV_PROFILE or default-profile in the config file)")
 	rootCmd.PersistentFlags().StringP("output", "o", "", "Output format. Empty for human-readable, 'json' or 'json-line'")
 	rootCmd.PersistentFlags().BoolP("help", "h", false, "Print help")
 	rootCmd.PersistentFlags().BoolP("debug", "d", false, "Print debug output")
 	rootCmd.PersistentFlags().BoolP("send", "s", false, "Send reports via e-mail (if false, print them to stdout)")
-	rootCmd.Flags().StringP("project", "p", "", "Redmine project name")
-	err := rootCmd.MarkFlagRequired("project")
-	if err != nil {
-		log.Fatalf(err.Error())
-	}
-
+	rootCmd.Flags().StringP("project", "p", "", "Redmine project name (default from the config profile)")
 }
 
 var rootCmd = &cobra.Command{
@@ -95,18 +90,22 @@ people with assigned review tasks.
 
 https://git.arvados.org/arvados-dev.git/cmd/review-task-reminder` +
 		"\nThe REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server." +
-		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key.",
+		"\nThe REDMINE_APIKEY environment variable must be set to your redmine API key." +
+		"\nBoth can also be set in a profile in the config file; see --config and --profile.",
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		if conf.Endpoint == "" {
 			cmd.Help()
 			fmt.Println()
-			fmt.Println("Error: the REDMINE_ENDPOINT environment variable must be set to the base URL of your redmine server")
+			fmt.Println("Error: the REDMINE_ENDPOINT environment variable (or endpoint in the config profile) must be set to the base URL of your redmine server")
 			os.Exit(1)
 		}
+		if err := conf.ResolveApikey(); err != nil {
+			log.Fatalf(err.Error())
+		}
 		if conf.Apikey == "" {
 			cmd.Help()
 			fmt.Println()
-			fmt.Println("Error: the REDMINE_APIKEY environment variable must be set to your redmine API key")
+			fmt.Println("Error: the REDMINE_APIKEY environment variable (or apikey in the config profile) must be set to your redmine API key")
 			os.Exit(1)
 		}
 		var err error
@@ -134,13 +133,23 @@ https://git.arvados.org/arvados-dev.git/cmd/review-task-reminder` +
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Debug("Creating redmine object")
-		rm := redmine.NewClient(conf.Endpoint, conf.Apikey)
+		rm := redmine.NewClient(conf.Endpoint, string(conf.Apikey))
+		if debug {
+			log.Debugf("Profile '%s' from %s, endpoint %s, API key %s from %s", conf.ProfileName, conf.Path, conf.Endpoint, conf.Apikey, conf.ApikeySource)
+			rm.Debug(log.StandardLogger().Out)
+		}
 
 		log.Debug("Getting project object")
 		project, err := cmd.Flags().GetString("project")
 		if err != nil {
 			log.Fatalf(err.Error())
 		}
+		if !cmd.Flags().Changed("project") && conf.Project != "" {
+			project = conf.Project
+		}
+		if project == "" {
+			log.Fatalf("the --project flag must be given, or project must be set in the config profile")
+		}
 		p, err := rm.GetProjectByName(project)
 		if err != nil {
 			log.Fatalf(err.Error())
@@ -329,7 +338,6 @@ func limit(text string, limit int) string {
 }
 
 func Execute() {
-	conf = loadConfig()
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
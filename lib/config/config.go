@@ -0,0 +1,179 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package config loads the settings shared by the arvados-dev tools from a
+// config file with named profiles, with overrides from the environment.
+//
+// An example config file:
+//
+//	default-profile: production
+//	profiles:
+//	  production:
+//	    endpoint: https://dev.arvados.org
+//	    project: arvados
+//	    source-repo: https://github.com/arvados/arvados.git
+//	    repo-path: ~/src/arvados
+//	    apikey-file: ~/.config/arvados-dev/production.key
+//	  dev-dev:
+//	    endpoint: https://dev-dev.arvados.org
+//	    project: arvados
+//	    credential-helper: "!f() { echo password=$(pass show redmine/dev-dev); }; f"
+//	  internal:
+//	    endpoint: https://dev.arvados.org
+//	    source-repo: git@git.internal.example:arvados.git
+//	    git-ssh-key: ~/.ssh/id_ed25519_mirror
+//	    git-known-hosts: ~/.ssh/known_hosts_internal
+//
+// The API key is taken from the first of these that is set: the
+// REDMINE_APIKEY environment variable, apikey in the profile, the file named
+// by apikey-file, the output of the credential-helper command, and the
+// password of the ~/.netrc entry for the endpoint host. The credential helper
+// is run like a git credential helper, with a "get" argument, and must print a
+// "password=" line: commands that print the bare secret, like "pass show",
+// need a wrapper such as the shell function above. Files that contain an API
+// key must not be accessible by other users.
+//
+// Git repositories are accessed over SSH with the git-ssh-key private key, or
+// else the keys of the ssh agent, and over HTTPS with git-token, sent as the
+// password of git-username if set, or else as a bearer token. The same
+// permission rules apply to a config file that contains a git-token or a
+// git-ssh-key-passphrase.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// Profile holds the settings for one Redmine instance
+type Profile struct {
+	Endpoint   string `mapstructure:"endpoint"`    // https://dev-dev.arvados.org
+	Apikey     Secret `mapstructure:"apikey"`      // abcde...
+	Project    string `mapstructure:"project"`     // default Redmine project
+	SourceRepo string `mapstructure:"source-repo"` // default git repository
+	RepoPath   string `mapstructure:"repo-path"`   // local checkout of the source repository
+
+	// Alternative sources for the API key
+	ApikeyFile       string `mapstructure:"apikey-file"`       // file containing the key
+	CredentialHelper string `mapstructure:"credential-helper"` // git-credential style helper
+	Netrc            string `mapstructure:"netrc"`             // netrc file, default ~/.netrc
+
+	// Credentials for the git repositories
+	GitSSHKey           string `mapstructure:"git-ssh-key"`            // private key file, default the ssh agent
+	GitSSHKeyPassphrase Secret `mapstructure:"git-ssh-key-passphrase"` // passphrase of the private key
+	GitKnownHosts       string `mapstructure:"git-known-hosts"`        // known hosts file, default ~/.ssh/known_hosts
+	GitUsername         string `mapstructure:"git-username"`           // user name for HTTPS remotes
+	GitToken            Secret `mapstructure:"git-token"`              // password or token for HTTPS remotes
+	GitHost             string `mapstructure:"git-host"`               // host git-token is for, default the host of source-repo
+}
+
+// Config is the selected profile, after environment overrides have been
+// applied
+type Config struct {
+	Profile
+	// ProfileName is the name of the selected profile, empty if none
+	ProfileName string
+	// Path is the config file the profile was read from, empty if none
+	Path string
+	// ApikeySource describes where the API key was found
+	ApikeySource string
+
+	apikeyResolved bool
+	apikeyErr      error
+}
+
+// DefaultPath returns the default location of the config file,
+// ~/.config/arvados-dev/config.yaml on Linux.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "arvados-dev", "config.yaml")
+}
+
+// Load reads the config file at path (or the default location if path is
+// empty) and returns the named profile. If profile is empty, the profile
+// named in the ARVADOS_DEV_PROFILE environment variable, or else the
+// default-profile set in the file, is used. A missing config file is only an
+// error if path or profile were given explicitly.
+//
+// The REDMINE_ENDPOINT, REDMINE_APIKEY, REDMINE_APIKEY_FILE and
+// REDMINE_PROJECT environment variables override the values in the profile.
+// The API key is only looked up in its other sources by ResolveApikey.
+func Load(path, profile string) (Config, error) {
+	var c Config
+
+	explicit := path != ""
+	if path == "" {
+		path = DefaultPath()
+	}
+	file := viper.New()
+	file.SetConfigFile(path)
+	file.SetConfigType("yaml")
+	err := file.ReadInConfig()
+	if err == nil {
+		c.Path = path
+	} else if explicit || !errors.Is(err, os.ErrNotExist) {
+		return c, fmt.Errorf("error reading config file %s: %s", path, err)
+	}
+
+	if profile == "" {
+		profile = os.Getenv("ARVADOS_DEV_PROFILE")
+	}
+	if profile == "" {
+		profile = file.GetString("default-profile")
+	}
+	if profile != "" {
+		sub := file.Sub("profiles." + profile)
+		if sub == nil {
+			return c, fmt.Errorf("profile '%s' not found in config file %s (available: %v)", profile, path, Profiles(file))
+		}
+		err = sub.Unmarshal(&c.Profile)
+		if err != nil {
+			return c, fmt.Errorf("error reading profile '%s' from %s: %s", profile, path, err)
+		}
+		c.ProfileName = profile
+	}
+
+	env := viper.New()
+	env.SetEnvPrefix("redmine") // will be uppercased automatically
+	env.BindEnv("endpoint")
+	env.BindEnv("apikey")
+	env.BindEnv("apikey_file")
+	env.BindEnv("project")
+	if v := env.GetString("endpoint"); v != "" {
+		c.Endpoint = v
+	}
+	if v := env.GetString("apikey"); v != "" {
+		c.Apikey = Secret(v)
+		c.ApikeySource = "environment"
+	} else if v := env.GetString("apikey_file"); v != "" {
+		c.Apikey = ""
+		c.ApikeyFile = v
+	}
+	if v := env.GetString("project"); v != "" {
+		c.Project = v
+	}
+
+	if c.GitToken != "" || c.GitSSHKeyPassphrase != "" {
+		err = checkPermissions(c.Path)
+	}
+	return c, err
+}
+
+// Profiles returns the names of the profiles defined in the config file
+func Profiles(file *viper.Viper) []string {
+	var names []string
+	for name := range file.GetStringMap("profiles") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,255 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Secret is a string that is redacted whenever it is formatted or
+// marshaled, so that it can not leak into debug output by accident. Convert
+// it to a string to use the actual value.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// ResolveApikey fills in c.Apikey from the first source that provides a
+// key: the profile itself, the apikey-file, the credential-helper or the
+// netrc file. c.ApikeySource describes where the key came from. The sources
+// are only consulted on the first call, so that commands that do not talk to
+// Redmine never run the credential helper.
+func (c *Config) ResolveApikey() error {
+	if !c.apikeyResolved {
+		c.apikeyErr = c.resolveApikey()
+		c.apikeyResolved = true
+	}
+	return c.apikeyErr
+}
+
+func (c *Config) resolveApikey() error {
+	if c.Apikey != "" {
+		if c.ApikeySource == "" {
+			c.ApikeySource = "config file " + c.Path
+			err := checkPermissions(c.Path)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if c.ApikeyFile != "" {
+		path := ExpandHome(c.ApikeyFile)
+		err := checkPermissions(path)
+		if err != nil {
+			return err
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading API key: %s", err)
+		}
+		c.Apikey = Secret(strings.TrimSpace(string(buf)))
+		c.ApikeySource = "file " + path
+		return nil
+	}
+	host := endpointHost(c.Endpoint)
+	if c.CredentialHelper != "" && host != "" {
+		key, err := credentialHelper(c.CredentialHelper, host)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			c.Apikey = key
+			c.ApikeySource = "credential helper " + c.CredentialHelper
+			return nil
+		}
+	}
+	if host != "" {
+		path := c.Netrc
+		if path == "" {
+			path = os.Getenv("NETRC")
+		}
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil
+			}
+			path = filepath.Join(home, ".netrc")
+		}
+		path = ExpandHome(path)
+		if _, err := os.Stat(path); err != nil {
+			// Not having a netrc file is fine
+			return nil
+		}
+		key, err := netrcPassword(path, host)
+		if err != nil {
+			return err
+		}
+		if key != "" {
+			err = checkPermissions(path)
+			if err != nil {
+				return err
+			}
+			c.Apikey = key
+			c.ApikeySource = "netrc file " + path
+		}
+	}
+	return nil
+}
+
+// checkPermissions returns an error if the file at path can be read or
+// written by anyone but its owner.
+func checkPermissions(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error reading API key: %s", err)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s contains credentials but is accessible by other users (mode %04o); run 'chmod 600 %s'", path, fi.Mode().Perm(), path)
+	}
+	return nil
+}
+
+// ExpandHome replaces a leading ~/ in path with the home directory
+func ExpandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// credentialHelper asks a git-credential style helper for the password for
+// host. Like in git, a helper that starts with "!" is run as a shell
+// command; anything else is run as an executable with the "get" argument.
+func credentialHelper(helper, host string) (Secret, error) {
+	var cmd *exec.Cmd
+	if strings.HasPrefix(helper, "!") {
+		cmd = exec.Command("/bin/sh", "-c", helper[1:]+" get")
+	} else {
+		cmd = exec.Command(ExpandHome(helper), "get")
+	}
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running credential helper '%s': %s", helper, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) == 2 && kv[0] == "password" {
+			return Secret(kv[1]), nil
+		}
+	}
+	return "", nil
+}
+
+// netrcPassword returns the password of the netrc entry for host, or of the
+// default entry if there is none.
+func netrcPassword(path, host string) (Secret, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var machine, password, fallback string
+	found := false
+	tokens := netrcTokens(string(buf))
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			if found {
+				return Secret(password), nil
+			}
+			if i+1 < len(tokens) {
+				i++
+				machine = tokens[i]
+				found = machine == host
+			}
+		case "default":
+			if found {
+				return Secret(password), nil
+			}
+			machine = ""
+		case "password":
+			if i+1 < len(tokens) {
+				i++
+				if found {
+					password = tokens[i]
+				} else if machine == "" {
+					fallback = tokens[i]
+				}
+			}
+		case "login", "account", "macdef":
+			// Skip the value
+			i++
+		}
+	}
+	if found {
+		return Secret(password), nil
+	}
+	return Secret(fallback), nil
+}
+
+// netrcTokens splits the content of a netrc file into tokens, leaving out
+// the bodies of macro definitions: they start on the line after "macdef
+// name" and run until the next blank line.
+func netrcTokens(netrc string) []string {
+	var tokens []string
+	macro := false
+	for _, line := range strings.Split(netrc, "\n") {
+		if macro {
+			macro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			tokens = append(tokens, f)
+			if f == "macdef" {
+				// Keep the name, which the caller skips like any value
+				name := ""
+				if i+1 < len(fields) {
+					name = fields[i+1]
+				}
+				tokens = append(tokens, name)
+				macro = true
+				break
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,45 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetrcPassword(t *testing.T) {
+	netrc := `machine git.example login bot password gitpass
+macdef init
+machine dev.arvados.org password macropass
+password macropass2
+
+machine dev.arvados.org
+  login me
+  password devpass
+macdef
+password unnamed
+
+default login anonymous password defaultpass
+`
+	path := filepath.Join(t.TempDir(), "netrc")
+	err := ioutil.WriteFile(path, []byte(netrc), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, expected := range map[string]Secret{
+		"git.example":     "gitpass",
+		"dev.arvados.org": "devpass",
+		"other.example":   "defaultpass",
+	} {
+		got, err := netrcPassword(path, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("%s: expected %q, got %q", host, string(expected), string(got))
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gitrelease
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Branch is an X.Y-staging branch, from which the patch releases of the
+// X.Y release line are made
+type Branch struct {
+	// Name is the name of the branch, e.g. 2.7-staging
+	Name string
+	// Ref is the full name of the reference, refs/heads/2.7-staging or
+	// refs/remotes/origin/2.7-staging in a checkout that does not have
+	// the local branch
+	Ref          string
+	Major, Minor int
+}
+
+// Line returns the release line of the branch, e.g. 2.7
+func (b Branch) Line() string {
+	return strconv.Itoa(b.Major) + "." + strconv.Itoa(b.Minor)
+}
+
+var reStagingBranch = regexp.MustCompile(`^refs/(?:heads|remotes/[^/]+)/((\d+)\.(\d+)-staging)$`)
+
+// StagingBranches returns the X.Y-staging branches of repo, oldest release
+// line first. Local branches are preferred over remote-tracking ones.
+func StagingBranches(repo *git.Repository) ([]Branch, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Branch)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		m := reStagingBranch.FindStringSubmatch(ref.Name().String())
+		if m == nil {
+			return nil
+		}
+		if b, ok := byName[m[1]]; ok && plumbing.ReferenceName(b.Ref).IsBranch() {
+			return nil
+		}
+		major, _ := strconv.Atoi(m[2])
+		minor, _ := strconv.Atoi(m[3])
+		byName[m[1]] = Branch{Name: m[1], Ref: ref.Name().String(), Major: major, Minor: minor}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var branches []Branch
+	for _, b := range byName {
+		branches = append(branches, b)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		if branches[i].Major != branches[j].Major {
+			return branches[i].Major < branches[j].Major
+		}
+		return branches[i].Minor < branches[j].Minor
+	})
+	return branches, nil
+}
+
+// Reachable returns the set of the commits reachable from rev
+func Reachable(repo *git.Repository, rev string) (map[plumbing.Hash]bool, error) {
+	head, err := Resolve(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	commits := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(head, nil, nil).ForEach(func(c *object.Commit) error {
+		commits[c.Hash] = true
+		return nil
+	})
+	return commits, err
+}
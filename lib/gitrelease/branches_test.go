@@ -0,0 +1,70 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gitrelease
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestStagingBranches(t *testing.T) {
+	r := newTestRepo(t)
+	c := r.commit("Initial commit\n")
+	r.branch("main", c)
+	r.branch("2.7-staging", c)
+	r.branch("1.4-staging", c)
+	r.branch("2.7-staging-old", c)
+	r.setRef("refs/remotes/origin/2.7-staging", c)
+	r.setRef("refs/remotes/origin/2.10-staging", c)
+	r.setRef("refs/remotes/origin/main", c)
+	r.tag("2.8-staging", c)
+
+	branches, err := StagingBranches(r.repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Branch{
+		{Name: "1.4-staging", Ref: "refs/heads/1.4-staging", Major: 1, Minor: 4},
+		{Name: "2.7-staging", Ref: "refs/heads/2.7-staging", Major: 2, Minor: 7},
+		{Name: "2.10-staging", Ref: "refs/remotes/origin/2.10-staging", Major: 2, Minor: 10},
+	}
+	if !reflect.DeepEqual(branches, expected) {
+		t.Errorf("expected %+v, got %+v", expected, branches)
+	}
+	if line := branches[2].Line(); line != "2.10" {
+		t.Errorf("expected line 2.10, got %s", line)
+	}
+}
+
+func TestReachable(t *testing.T) {
+	r := newReleaseHistory(t)
+	other := r.commit("Unrelated\n", r.init)
+	r.branch("other", other)
+
+	commits, err := Reachable(r.repo, "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[plumbing.Hash]bool{r.init: true}; !reflect.DeepEqual(commits, expected) {
+		t.Errorf("expected %v, got %v", expected, commits)
+	}
+	commits, err = Reachable(r.repo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []plumbing.Hash{r.init, r.feature100, r.mergeIntoFeature, r.merge300, r.head} {
+		if !commits[h] {
+			t.Errorf("expected %s to be reachable from main", h)
+		}
+	}
+	if commits[other] {
+		t.Errorf("expected %s not to be reachable from main", other)
+	}
+	if _, err := Reachable(r.repo, "no-such-branch"); err == nil {
+		t.Errorf("expected an error for an unknown revision")
+	}
+}
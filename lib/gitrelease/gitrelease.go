@@ -0,0 +1,467 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package gitrelease finds the Redmine issues that went into a release by
+// analyzing the git history between two revisions.
+//
+// Feature branches are merged with a merge commit whose message refers to
+// the issue the branch implements, e.g.
+//
+//	Merge branch '12345-new-feature'
+//
+//	refs #12345
+//
+// (a git commit hook enforces the issue reference on merges). A merge can
+// refer to several issues ("refs #123 #456", "closes #123, fixes #456"), or
+// state that it has none ("no issue #").
+//
+// Patch releases are built from X.Y-staging branches, where fixes are
+// cherry-picked with "git cherry-pick -x" instead of merged. These commits
+// are recognized by their "(cherry picked from commit ...)" trailer, and
+// mapped to the issues referenced by the commit message, its "12345: "
+// prefix (the Arvados convention for commits on feature branches), the
+// original commit, or the merge that brought the original commit into the
+// main branch.
+//
+// Merges can be reverted before a release, with a commit like
+//
+//	Revert "Merge branch '12345-new-feature'"
+//
+//	This reverts commit 0123456789abcdef0123456789abcdef01234567, ...
+//
+// Such commits are returned as references to the issues of the reverted
+// commit, and the references of reverted commits are marked as such, so that
+// IsReverted can tell which issues did not make it into the release.
+package gitrelease
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Values of the IssueRef Kind field
+const (
+	// KindMerge is the merge of a feature branch
+	KindMerge = "merge"
+	// KindNoIssue is a merge that states it has no issue ("no issue #").
+	// Its Issue is 0.
+	KindNoIssue = "no-issue"
+	// KindCherryPick is a fix cherry-picked from another branch
+	KindCherryPick = "cherry-pick"
+	// KindRevert is the revert of a commit that referenced the issue
+	KindRevert = "revert"
+)
+
+// Options control what the analysis looks for
+type Options struct {
+	// CherryPicks enables the scan of non-merge commits for cherry-picks
+	CherryPicks bool
+	// MainBranch is the branch cherry-picks are taken from, "main" (or
+	// "master") by default
+	MainBranch string
+}
+
+// IssueRef is a reference to a Redmine issue found in a commit
+type IssueRef struct {
+	Issue  int
+	Commit *object.Commit
+	Kind   string
+	// Ref is the text of the reference, e.g. "refs #123 #456"
+	Ref string
+	// CherryPickOf is the original commit of a cherry-pick
+	CherryPickOf plumbing.Hash
+	// RevertOf is the commit a revert reverts
+	RevertOf plumbing.Hash
+	// Reverted is set when Commit was reverted (and the revert was not
+	// itself reverted) before toRef
+	Reverted bool
+}
+
+var (
+	reMerge    = regexp.MustCompile(`Merge branch `)
+	reNotMain  = regexp.MustCompile(`Merge branch .(main|master)`)
+	reIssueRef = regexp.MustCompile(`(?i)\b(?:refs?|references|close[sd]?|fix(?:e[sd])?|resolve[sd]?) *:? *#\d+(?:(?: *, *| +and +| +)#\d+)*`)
+	reNoIssue  = regexp.MustCompile(`(?i)\bno issue #`)
+	reIssueID  = regexp.MustCompile(`#(\d+)`)
+
+	reCherryPick  = regexp.MustCompile(`\(cherry picked from commit ([0-9a-f]{40})\)`)
+	reIssuePrefix = regexp.MustCompile(`^(\d{4,}): `)
+	reRevert      = regexp.MustCompile(`This reverts commit ([0-9a-f]{40})`)
+)
+
+// messageRefs returns all the issue references in a commit message
+func messageRefs(c *object.Commit, kind string) []IssueRef {
+	var refs []IssueRef
+	seen := make(map[int]bool)
+	for _, ref := range reIssueRef.FindAllString(c.Message, -1) {
+		for _, m := range reIssueID.FindAllStringSubmatch(ref, -1) {
+			i, err := strconv.Atoi(m[1])
+			if err != nil || seen[i] {
+				continue
+			}
+			seen[i] = true
+			refs = append(refs, IssueRef{Issue: i, Commit: c, Kind: kind, Ref: ref})
+		}
+	}
+	if len(refs) == 0 && reNoIssue.MatchString(c.Message) {
+		refs = append(refs, IssueRef{Commit: c, Kind: KindNoIssue, Ref: reNoIssue.FindString(c.Message)})
+	}
+	return refs
+}
+
+// prefixRef returns the issue reference of the "12345: " prefix of a commit
+// message, if it has one
+func prefixRef(msg string) (IssueRef, bool) {
+	p := reIssuePrefix.FindStringSubmatch(msg)
+	if p == nil {
+		return IssueRef{}, false
+	}
+	i, _ := strconv.Atoi(p[1])
+	return IssueRef{Issue: i, Ref: strings.TrimSpace(p[0])}, true
+}
+
+// scanner holds the state of a Scan
+type scanner struct {
+	repo *git.Repository
+	opts Options
+	// mergedBy maps the commits of the main branch to the merge that
+	// brought them in, built on first use
+	mergedBy map[plumbing.Hash]*object.Commit
+}
+
+// mergeOf returns the merge commit of the main branch that brought in the
+// commit h, or nil
+func (s *scanner) mergeOf(h plumbing.Hash) *object.Commit {
+	if s.mergedBy == nil {
+		s.mergedBy = make(map[plumbing.Hash]*object.Commit)
+		branches := []string{s.opts.MainBranch}
+		if s.opts.MainBranch == "" {
+			branches = []string{"main", "master"}
+		}
+		var head *object.Commit
+		for _, b := range branches {
+			if c, err := Resolve(s.repo, b); err == nil {
+				head = c
+				break
+			}
+		}
+		if head == nil {
+			return nil
+		}
+		// Walk the first parents (the main line), oldest first, and
+		// attribute the commits each merge brings in that are not
+		// already on the main line
+		var mainline []*object.Commit
+		for c := head; c != nil; {
+			mainline = append(mainline, c)
+			p, err := c.Parent(0)
+			if err != nil {
+				break
+			}
+			c = p
+		}
+		covered := make(map[plumbing.Hash]bool)
+		for n := len(mainline) - 1; n >= 0; n-- {
+			m := mainline[n]
+			covered[m.Hash] = true
+			if len(m.ParentHashes) < 2 {
+				continue
+			}
+			queue := m.ParentHashes[1:]
+			for len(queue) > 0 {
+				ph := queue[0]
+				queue = queue[1:]
+				if covered[ph] {
+					continue
+				}
+				covered[ph] = true
+				s.mergedBy[ph] = m
+				if c, err := s.repo.CommitObject(ph); err == nil {
+					queue = append(queue, c.ParentHashes...)
+				}
+			}
+		}
+	}
+	return s.mergedBy[h]
+}
+
+// cherryPickRefs returns the issue references of a cherry-picked commit,
+// or nil if c is not a cherry-pick
+func (s *scanner) cherryPickRefs(c *object.Commit) []IssueRef {
+	m := reCherryPick.FindStringSubmatch(c.Message)
+	if m == nil {
+		return nil
+	}
+	origin := plumbing.NewHash(m[1])
+	refs := messageRefs(c, KindCherryPick)
+	if r, ok := prefixRef(c.Message); len(refs) == 0 && ok {
+		refs = append(refs, r)
+	}
+	if len(refs) == 0 {
+		// The message may have been edited, try the original commit
+		if oc, err := s.repo.CommitObject(origin); err == nil {
+			refs = messageRefs(oc, KindCherryPick)
+			if r, ok := prefixRef(oc.Message); len(refs) == 0 && ok {
+				refs = append(refs, r)
+			}
+		}
+	}
+	if len(refs) == 0 {
+		if merge := s.mergeOf(origin); merge != nil {
+			refs = messageRefs(merge, KindCherryPick)
+		}
+	}
+	if len(refs) == 0 {
+		refs = append(refs, IssueRef{Ref: strings.Trim(m[0], "()")})
+	}
+	for i := range refs {
+		refs[i].Commit = c
+		refs[i].Kind = KindCherryPick
+		refs[i].CherryPickOf = origin
+	}
+	return refs
+}
+
+// revertRefs returns the issue references of the commit reverted by c, or
+// nil if c is not a revert
+func (s *scanner) revertRefs(c *object.Commit) []IssueRef {
+	m := reRevert.FindStringSubmatch(c.Message)
+	if m == nil {
+		return nil
+	}
+	reverted := plumbing.NewHash(m[1])
+	var refs []IssueRef
+	if rc, err := s.repo.CommitObject(reverted); err == nil {
+		if len(rc.ParentHashes) >= 2 {
+			refs = messageRefs(rc, KindRevert)
+		} else if rr := s.revertRefs(rc); rr != nil {
+			// The revert of a revert brings the changes back
+			refs = rr
+		} else if cp := s.cherryPickRefs(rc); cp != nil {
+			refs = cp
+		} else if r, ok := prefixRef(rc.Message); ok {
+			refs = append(refs, r)
+		}
+	}
+	if len(refs) == 0 {
+		refs = append(refs, IssueRef{Ref: "no issue reference"})
+	}
+	for i := range refs {
+		refs[i] = IssueRef{Issue: refs[i].Issue, Commit: c, Kind: KindRevert, Ref: refs[i].Ref, RevertOf: reverted}
+	}
+	return refs
+}
+
+// commitRefs returns the issue references of a commit: those of a revert,
+// of a cherry-pick if enabled, or of the merge of a feature branch
+func (s *scanner) commitRefs(c *object.Commit) []IssueRef {
+	if reverts := s.revertRefs(c); reverts != nil {
+		return reverts
+	} else if len(c.ParentHashes) < 2 {
+		if s.opts.CherryPicks {
+			return s.cherryPickRefs(c)
+		}
+	} else if reMerge.MatchString(c.Message) && !reNotMain.MatchString(c.Message) {
+		return messageRefs(c, KindMerge)
+	}
+	return nil
+}
+
+// markReverted sets the Reverted field of the references whose commit was
+// reverted by a revert that is not itself reverted
+func markReverted(refs []IssueRef) {
+	revertsOf := make(map[plumbing.Hash][]plumbing.Hash)
+	for _, r := range refs {
+		if r.Kind == KindRevert {
+			revertsOf[r.RevertOf] = append(revertsOf[r.RevertOf], r.Commit.Hash)
+		}
+	}
+	memo := make(map[plumbing.Hash]bool)
+	var isReverted func(h plumbing.Hash, depth int) bool
+	isReverted = func(h plumbing.Hash, depth int) bool {
+		if v, ok := memo[h]; ok || depth > 100 {
+			return v
+		}
+		for _, rh := range revertsOf[h] {
+			if !isReverted(rh, depth+1) {
+				memo[h] = true
+				return true
+			}
+		}
+		memo[h] = false
+		return false
+	}
+	for i := range refs {
+		refs[i].Reverted = isReverted(refs[i].Commit.Hash, 0)
+	}
+}
+
+// IsReverted tells whether the changes for an issue were reverted, given all
+// its references: there is a revert, and every commit that brought changes
+// in was reverted.
+func IsReverted(refs []IssueRef) bool {
+	reverts := false
+	for _, r := range refs {
+		if r.Kind == KindRevert {
+			reverts = reverts || !r.Reverted
+		} else if !r.Reverted {
+			return false
+		}
+	}
+	return reverts
+}
+
+// ByIssue groups references by issue, keeping their order. References
+// without an issue are left out.
+func ByIssue(refs []IssueRef) map[int][]IssueRef {
+	byIssue := make(map[int][]IssueRef)
+	for _, r := range refs {
+		if r.Issue != 0 {
+			byIssue[r.Issue] = append(byIssue[r.Issue], r)
+		}
+	}
+	return byIssue
+}
+
+// String describes the reference as evidence, with the abbreviated commit
+// hash, the first line of the commit message and the reference
+func (r IssueRef) String() string {
+	subject := strings.SplitN(strings.TrimSpace(r.Commit.Message), "\n", 2)[0]
+	if r.Kind == KindRevert {
+		return fmt.Sprintf("%.10s %s (reverts %.10s, %s)", r.Commit.Hash, subject, r.RevertOf, r.Ref)
+	}
+	if r.Kind == KindCherryPick {
+		return fmt.Sprintf("%.10s %s (cherry-pick of %.10s, %s)", r.Commit.Hash, subject, r.CherryPickOf, r.Ref)
+	}
+	return fmt.Sprintf("%.10s %s (%s)", r.Commit.Hash, subject, r.Ref)
+}
+
+// Resolve returns the commit a revision (a tag, branch, or full or
+// abbreviated commit hash) points to
+func Resolve(repo *git.Repository, rev string) (*object.Commit, error) {
+	h, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("can not resolve '%s': %s", rev, err)
+	}
+	return repo.CommitObject(*h)
+}
+
+// IssuesBetween returns all the issue references of the merge commits that
+// are reachable from toRef but not from fromRef, most recent first. Merges
+// of the main branch into feature branches are ignored.
+func IssuesBetween(repo *git.Repository, fromRef, toRef string) ([]IssueRef, error) {
+	return Scan(repo, fromRef, toRef, Options{})
+}
+
+// Scan is IssuesBetween with options. Cherry-picks without any issue
+// reference are returned with Issue 0.
+func Scan(repo *git.Repository, fromRef, toRef string, opts Options) ([]IssueRef, error) {
+	start, err := Resolve(repo, fromRef)
+	if err != nil {
+		return nil, err
+	}
+	head, err := Resolve(repo, toRef)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scanner{repo: repo, opts: opts}
+
+	// Build the exclusion list
+	seen := make(map[plumbing.Hash]bool)
+	excludeIter, err := repo.Log(&git.LogOptions{From: start.Hash, Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, err
+	}
+	err = excludeIter.ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// isValid returns the commits that are not in the exclusion list
+	var isValid object.CommitFilter = func(commit *object.Commit) bool {
+		return !seen[commit.Hash]
+	}
+	// isLimit stops the walk at the previous release
+	var isLimit object.CommitFilter = func(commit *object.Commit) bool {
+		return seen[commit.Hash]
+	}
+	iter := object.NewFilterCommitIter(head, &isValid, &isLimit)
+
+	var refs []IssueRef
+	err = iter.ForEach(func(c *object.Commit) error {
+		refs = append(refs, s.commitRefs(c)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	markReverted(refs)
+	return refs, nil
+}
+
+// Find returns the references to issue in all the commits reachable from
+// the branches and tags of repo: the merges that refer to it, the
+// cherry-picks of its fixes if opts.CherryPicks is set, and their reverts.
+// The Reverted field is not set, since a commit can be reverted on one
+// branch and not on another; see Shipped.
+func Find(repo *git.Repository, issue int, opts Options) ([]IssueRef, error) {
+	index, err := Index(repo, opts)
+	if err != nil {
+		return nil, err
+	}
+	return index[issue], nil
+}
+
+// Index is Find for all issues at once: it returns the references found in
+// all the commits reachable from the branches and tags of repo, by issue.
+func Index(repo *git.Repository, opts Options) (map[int][]IssueRef, error) {
+	iter, err := repo.Log(&git.LogOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	s := &scanner{repo: repo, opts: opts}
+	var refs []IssueRef
+	err = iter.ForEach(func(c *object.Commit) error {
+		refs = append(refs, s.commitRefs(c)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ByIssue(refs), nil
+}
+
+// Shipped tells whether the changes of refs (as returned by Find) are in
+// the set of commits: one of their merges or cherry-picks is, and is not
+// undone there (see Undone).
+func Shipped(refs []IssueRef, commits map[plumbing.Hash]bool) bool {
+	for _, r := range refs {
+		if r.Kind != KindRevert && commits[r.Commit.Hash] && !Undone(refs, commits, r.Commit.Hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Undone tells whether the commit h of refs (as returned by Find) is undone
+// in the set of commits: one of its reverts is in the set, and is not itself
+// undone there.
+func Undone(refs []IssueRef, commits map[plumbing.Hash]bool, h plumbing.Hash) bool {
+	for _, r := range refs {
+		if r.Kind == KindRevert && r.RevertOf == h && commits[r.Commit.Hash] && !Undone(refs, commits, r.Commit.Hash) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,541 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gitrelease
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// testRepo builds a history in an in-memory repository. Commits have an
+// empty tree, and each one is a minute younger than the previous one.
+type testRepo struct {
+	t    *testing.T
+	repo *git.Repository
+	tree plumbing.Hash
+	when time.Time
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRepo{t: t, repo: repo, when: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	obj := repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{}).Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	r.tree, err = repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// commit adds a commit with the given message and parents
+func (r *testRepo) commit(msg string, parents ...plumbing.Hash) plumbing.Hash {
+	r.when = r.when.Add(time.Minute)
+	sig := object.Signature{Name: "Tester", Email: "tester@example.com", When: r.when}
+	c := &object.Commit{Author: sig, Committer: sig, Message: msg, TreeHash: r.tree, ParentHashes: parents}
+	obj := r.repo.Storer.NewEncodedObject()
+	if err := c.Encode(obj); err != nil {
+		r.t.Fatal(err)
+	}
+	h, err := r.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return h
+}
+
+func (r *testRepo) setRef(name plumbing.ReferenceName, h plumbing.Hash) {
+	if err := r.repo.Storer.SetReference(plumbing.NewHashReference(name, h)); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r *testRepo) branch(name string, h plumbing.Hash) {
+	r.setRef(plumbing.NewBranchReferenceName(name), h)
+}
+
+func (r *testRepo) tag(name string, h plumbing.Hash) {
+	r.setRef(plumbing.NewTagReferenceName(name), h)
+}
+
+// refSummary is the part of an IssueRef the tests compare
+type refSummary struct {
+	Issue  int
+	Commit plumbing.Hash
+	Kind   string
+}
+
+func summarize(refs []IssueRef) []refSummary {
+	var s []refSummary
+	for _, r := range refs {
+		s = append(s, refSummary{Issue: r.Issue, Commit: r.Commit.Hash, Kind: r.Kind})
+	}
+	return s
+}
+
+// releaseHistory is a main branch with feature merges between the 1.0.0 and
+// 1.1.0 tags
+type releaseHistory struct {
+	*testRepo
+	init, feature100, mergeIntoFeature, merge100, merge200, mergeTypo, merge300, direct, head plumbing.Hash
+}
+
+func newReleaseHistory(t *testing.T) *releaseHistory {
+	r := &releaseHistory{testRepo: newTestRepo(t)}
+	r.init = r.commit("Initial commit\n")
+	r.tag("1.0.0", r.init)
+
+	// A feature branch that merges main before being merged
+	r.feature100 = r.commit("1100: Add the feature\n", r.init)
+	fix := r.commit("Fix the build on main\n\nrefs #1999\n", r.init)
+	r.mergeIntoFeature = r.commit("Merge branch 'main' into 1100-feature\n\nrefs #1999\n", r.feature100, fix)
+	r.merge100 = r.commit("Merge branch '1100-feature'\n\nrefs #1100\n", fix, r.mergeIntoFeature)
+
+	// Several references, one of them twice
+	feature200 := r.commit("Fix things\n", r.merge100)
+	r.merge200 = r.commit("Merge branch '1200-fixes'\n\ncloses #1200, fixes #1201\nrefs #1200\n", r.merge100, feature200)
+
+	typo := r.commit("Fix a typo\n", r.merge200)
+	r.mergeTypo = r.commit("Merge branch 'typo'\n\nno issue #\n", r.merge200, typo)
+
+	feature300 := r.commit("1300: Refactor\n", r.mergeTypo)
+	r.merge300 = r.commit("Merge branch '1300-refactor'\n\nRefs #1300 #1301 and #1302\n", r.mergeTypo, feature300)
+
+	// Issue references in commits that are not merges are not counted
+	r.direct = r.commit("Quick fix\n\nrefs #1400\n", r.merge300)
+	r.head = r.direct
+	r.branch("main", r.head)
+	r.tag("1.1.0", r.head)
+	return r
+}
+
+func TestIssuesBetween(t *testing.T) {
+	r := newReleaseHistory(t)
+	refs, err := IssuesBetween(r.repo, "1.0.0", "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []refSummary{
+		{1300, r.merge300, KindMerge},
+		{1301, r.merge300, KindMerge},
+		{1302, r.merge300, KindMerge},
+		{0, r.mergeTypo, KindNoIssue},
+		{1200, r.merge200, KindMerge},
+		{1201, r.merge200, KindMerge},
+		{1100, r.merge100, KindMerge},
+	}
+	if got := summarize(refs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if refs[0].Ref != "Refs #1300 #1301 and #1302" {
+		t.Errorf("unexpected reference text %q", refs[0].Ref)
+	}
+
+	// The range excludes what the previous release contains
+	refs, err = IssuesBetween(r.repo, r.merge200.String(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []refSummary{
+		{1300, r.merge300, KindMerge},
+		{1301, r.merge300, KindMerge},
+		{1302, r.merge300, KindMerge},
+		{0, r.mergeTypo, KindNoIssue},
+	}
+	if got := summarize(refs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	if _, err := IssuesBetween(r.repo, "0.9.0", "1.1.0"); err == nil {
+		t.Errorf("expected an error for an unknown revision")
+	}
+}
+
+func TestMessageRefs(t *testing.T) {
+	for _, tc := range []struct {
+		msg    string
+		issues []int
+		kind   string
+	}{
+		{msg: "Merge branch '1-a'\n\nrefs #1\n", issues: []int{1}, kind: KindMerge},
+		{msg: "Merge branch '1-a'\n\nRefs: #1\n", issues: []int{1}, kind: KindMerge},
+		{msg: "Merge branch '1-a'\n\nref #1, #2\n", issues: []int{1, 2}, kind: KindMerge},
+		{msg: "Merge branch '1-a'\n\ncloses #1, fixes #2\nresolves #3\n", issues: []int{1, 2, 3}, kind: KindMerge},
+		{msg: "Merge branch '1-a'\n\nfixes #3 and #4\n", issues: []int{3, 4}, kind: KindMerge},
+		{msg: "Merge branch '1-a'\n\nrefs #1\nrefs #1 #2\n", issues: []int{1, 2}, kind: KindMerge},
+		{msg: "Merge branch '1-a'\n\nsee #5\n", issues: nil},
+		{msg: "Merge branch '1-a'\n\nxrefs #5\n", issues: nil},
+		{msg: "Merge branch '1-a'\n\n#5\n", issues: nil},
+		{msg: "Merge branch 'typo'\n\nNo issue #\n", issues: []int{0}, kind: KindNoIssue},
+		{msg: "Merge branch 'typo'\n\nrefs #6, no issue #\n", issues: []int{6}, kind: KindMerge},
+	} {
+		c := &object.Commit{Message: tc.msg}
+		refs := messageRefs(c, KindMerge)
+		var issues []int
+		for _, r := range refs {
+			issues = append(issues, r.Issue)
+			if r.Kind != tc.kind {
+				t.Errorf("%q: expected kind %s, got %s", tc.msg, tc.kind, r.Kind)
+			}
+			if r.Commit != c {
+				t.Errorf("%q: the reference is not to the commit", tc.msg)
+			}
+		}
+		if !reflect.DeepEqual(issues, tc.issues) {
+			t.Errorf("%q: expected issues %v, got %v", tc.msg, tc.issues, issues)
+		}
+	}
+}
+
+func TestNotMain(t *testing.T) {
+	for msg, ignored := range map[string]bool{
+		"Merge branch 'main' into 1100-feature":                          true,
+		"Merge branch 'master' of git.arvados.org:arvados into 1100-foo": true,
+		"Merge branch '1100-feature'":                                    false,
+		"Merge branch '1100-main-page'":                                  false,
+	} {
+		if got := reNotMain.MatchString(msg); got != ignored {
+			t.Errorf("%q: expected %v, got %v", msg, ignored, got)
+		}
+	}
+}
+
+func TestByIssue(t *testing.T) {
+	r := newReleaseHistory(t)
+	refs, err := IssuesBetween(r.repo, "1.0.0", "1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byIssue := ByIssue(refs)
+	var issues []int
+	for i := range byIssue {
+		issues = append(issues, i)
+	}
+	sort.Ints(issues)
+	if expected := []int{1100, 1200, 1201, 1300, 1301, 1302}; !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected issues %v, got %v", expected, issues)
+	}
+	if got := summarize(byIssue[1200]); !reflect.DeepEqual(got, []refSummary{{1200, r.merge200, KindMerge}}) {
+		t.Errorf("unexpected references for #1200: %+v", got)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := newReleaseHistory(t)
+	for rev, expected := range map[string]plumbing.Hash{
+		"1.0.0":                   r.init,
+		"refs/tags/1.1.0":         r.head,
+		"main":                    r.head,
+		r.merge200.String():       r.merge200,
+		r.merge200.String()[:7]:   r.merge200,
+		"refs/heads/main":         r.head,
+		r.merge100.String()[:10]:  r.merge100,
+		r.mergeTypo.String()[:40]: r.mergeTypo,
+	} {
+		c, err := Resolve(r.repo, rev)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", rev, err)
+		} else if c.Hash != expected {
+			t.Errorf("%s: expected %s, got %s", rev, expected, c.Hash)
+		}
+	}
+	if _, err := Resolve(r.repo, "no-such-branch"); err == nil {
+		t.Errorf("expected an error for an unknown revision")
+	}
+}
+
+// secondParent returns the commit a merge brought in
+func (r *testRepo) secondParent(h plumbing.Hash) plumbing.Hash {
+	c, err := r.repo.CommitObject(h)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return c.ParentHashes[1]
+}
+
+func TestMergeOf(t *testing.T) {
+	r := newReleaseHistory(t)
+	s := &scanner{repo: r.repo}
+	for name, tc := range map[string]struct{ commit, merge plumbing.Hash }{
+		"feature commit":          {r.feature100, r.merge100},
+		"merge of main":           {r.mergeIntoFeature, r.merge100},
+		"last feature commit":     {r.secondParent(r.merge300), r.merge300},
+		"commit on the main line": {r.merge200, plumbing.ZeroHash},
+		"unknown commit":          {plumbing.NewHash("0123456789abcdef0123456789abcdef01234567"), plumbing.ZeroHash},
+	} {
+		got := plumbing.ZeroHash
+		if m := s.mergeOf(tc.commit); m != nil {
+			got = m.Hash
+		}
+		if got != tc.merge {
+			t.Errorf("%s: expected %s, got %s", name, tc.merge, got)
+		}
+	}
+
+	s = &scanner{repo: r.repo, opts: Options{MainBranch: "master"}}
+	if m := s.mergeOf(r.feature100); m != nil {
+		t.Errorf("expected no merge without the main branch, got %s", m.Hash)
+	}
+}
+
+func TestCherryPicks(t *testing.T) {
+	r := newReleaseHistory(t)
+	feature200 := r.secondParent(r.merge200)
+	typo := r.secondParent(r.mergeTypo)
+	feature300 := r.secondParent(r.merge300)
+	unmerged := r.commit("Experiment\n", r.init)
+	pick := func(msg string, origin plumbing.Hash, parent plumbing.Hash) plumbing.Hash {
+		return r.commit(msg+"\n\n(cherry picked from commit "+origin.String()+")\n", parent)
+	}
+	// The issue from the "1100: " prefix
+	cp100 := pick("1100: Add the feature", r.feature100, r.init)
+	// From the merge that brought in the original commit
+	cp200 := pick("Fix things", feature200, cp100)
+	// From the message itself
+	cp500 := pick("Fix a typo\n\nrefs #1500", typo, cp200)
+	// From the original commit, when the message was edited
+	cp300 := pick("Refactor", feature300, cp500)
+	// None at all
+	cpNone := pick("Experiment", unmerged, cp300)
+	r.branch("1.0-staging", cpNone)
+	r.tag("1.0.1", cpNone)
+
+	refs, err := Scan(r.repo, "1.0.0", "1.0.1", Options{CherryPicks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []refSummary{
+		{0, cpNone, KindCherryPick},
+		{1300, cp300, KindCherryPick},
+		{1500, cp500, KindCherryPick},
+		{1200, cp200, KindCherryPick},
+		{1201, cp200, KindCherryPick},
+		{1100, cp100, KindCherryPick},
+	}
+	if got := summarize(refs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+	for _, ref := range refs {
+		c, err := r.repo.CommitObject(ref.Commit.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if origin := reCherryPick.FindStringSubmatch(c.Message)[1]; ref.CherryPickOf.String() != origin {
+			t.Errorf("%s: expected CherryPickOf %s, got %s", ref, origin, ref.CherryPickOf)
+		}
+	}
+	if refs[0].Ref != "cherry picked from commit "+unmerged.String() {
+		t.Errorf("unexpected reference text %q", refs[0].Ref)
+	}
+	if refs[5].Ref != "1100:" {
+		t.Errorf("unexpected reference text %q", refs[5].Ref)
+	}
+
+	// Cherry-picks are only looked for when enabled
+	refs, err = Scan(r.repo, "1.0.0", "1.0.1", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 0 {
+		t.Errorf("expected no references without CherryPicks, got %+v", summarize(refs))
+	}
+}
+
+// revert adds a commit that reverts h, with the message git makes
+func (r *testRepo) revert(h plumbing.Hash, parent plumbing.Hash) plumbing.Hash {
+	c, err := r.repo.CommitObject(h)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	subject := strings.SplitN(c.Message, "\n", 2)[0]
+	return r.commit("Revert \""+subject+"\"\n\nThis reverts commit "+h.String()+".\n", parent)
+}
+
+func TestReverts(t *testing.T) {
+	r := newReleaseHistory(t)
+	revert100 := r.revert(r.merge100, r.head)
+	revert1300 := r.revert(r.merge300, revert100)
+	// Changed our mind about 1300
+	revertRevert1300 := r.revert(revert1300, revert1300)
+	// A revert of a commit without any issue reference
+	revertTypo := r.revert(r.secondParent(r.mergeTypo), revertRevert1300)
+	r.branch("main", revertTypo)
+
+	refs, err := Scan(r.repo, "1.0.0", "main", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []refSummary{
+		{0, revertTypo, KindRevert},
+		{1300, revertRevert1300, KindRevert},
+		{1301, revertRevert1300, KindRevert},
+		{1302, revertRevert1300, KindRevert},
+		{1300, revert1300, KindRevert},
+		{1301, revert1300, KindRevert},
+		{1302, revert1300, KindRevert},
+		{1100, revert100, KindRevert},
+		{1300, r.merge300, KindMerge},
+		{1301, r.merge300, KindMerge},
+		{1302, r.merge300, KindMerge},
+		{0, r.mergeTypo, KindNoIssue},
+		{1200, r.merge200, KindMerge},
+		{1201, r.merge200, KindMerge},
+		{1100, r.merge100, KindMerge},
+	}
+	if got := summarize(refs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+	if refs[0].Ref != "no issue reference" {
+		t.Errorf("unexpected reference text %q", refs[0].Ref)
+	}
+	for _, ref := range refs {
+		var revertOf plumbing.Hash
+		var reverted bool
+		switch ref.Commit.Hash {
+		case revertTypo:
+			revertOf = r.secondParent(r.mergeTypo)
+		case revertRevert1300:
+			revertOf = revert1300
+		case revert1300:
+			revertOf, reverted = r.merge300, true
+		case revert100:
+			revertOf = r.merge100
+		case r.merge100:
+			reverted = true
+		}
+		if ref.RevertOf != revertOf {
+			t.Errorf("%s: expected RevertOf %s, got %s", ref, revertOf, ref.RevertOf)
+		}
+		if ref.Reverted != reverted {
+			t.Errorf("%s: expected Reverted %v, got %v", ref, reverted, ref.Reverted)
+		}
+	}
+
+	byIssue := ByIssue(refs)
+	for issue, reverted := range map[int]bool{1100: true, 1200: false, 1300: false, 1301: false} {
+		if got := IsReverted(byIssue[issue]); got != reverted {
+			t.Errorf("#%d: expected IsReverted %v, got %v", issue, reverted, got)
+		}
+	}
+}
+
+func TestRevertCherryPick(t *testing.T) {
+	r := newReleaseHistory(t)
+	cp := r.commit("1100: Add the feature\n\n(cherry picked from commit "+r.feature100.String()+")\n", r.init)
+	revert := r.revert(cp, cp)
+	r.branch("1.0-staging", revert)
+
+	refs, err := Scan(r.repo, "1.0.0", "1.0-staging", Options{CherryPicks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []refSummary{
+		{1100, revert, KindRevert},
+		{1100, cp, KindCherryPick},
+	}
+	if got := summarize(refs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+	if !refs[1].Reverted || !IsReverted(refs) {
+		t.Errorf("expected the cherry-pick to be reverted")
+	}
+}
+
+func TestIsReverted(t *testing.T) {
+	c1 := &object.Commit{Hash: plumbing.NewHash("01")}
+	c2 := &object.Commit{Hash: plumbing.NewHash("02")}
+	for name, tc := range map[string]struct {
+		refs     []IssueRef
+		reverted bool
+	}{
+		"no reference":  {nil, false},
+		"merge":         {[]IssueRef{{Commit: c1, Kind: KindMerge}}, false},
+		"reverted":      {[]IssueRef{{Commit: c2, Kind: KindRevert}, {Commit: c1, Kind: KindMerge, Reverted: true}}, true},
+		"merged again":  {[]IssueRef{{Commit: c2, Kind: KindMerge}, {Commit: c2, Kind: KindRevert}, {Commit: c1, Kind: KindMerge, Reverted: true}}, false},
+		"revert only":   {[]IssueRef{{Commit: c2, Kind: KindRevert}}, true},
+		"revert undone": {[]IssueRef{{Commit: c2, Kind: KindRevert, Reverted: true}, {Commit: c1, Kind: KindMerge}}, false},
+	} {
+		if got := IsReverted(tc.refs); got != tc.reverted {
+			t.Errorf("%s: expected %v, got %v", name, tc.reverted, got)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	r := newReleaseHistory(t)
+	index, err := Index(r.repo, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issues []int
+	for issue := range index {
+		issues = append(issues, issue)
+	}
+	sort.Ints(issues)
+	if expected := []int{1100, 1200, 1201, 1300, 1301, 1302}; !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected issues %v, got %v", expected, issues)
+	}
+	if got, expected := summarize(index[1200]), []refSummary{{1200, r.merge200, KindMerge}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	refs, err := Find(r.repo, 1100, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := summarize(refs), []refSummary{{1100, r.merge100, KindMerge}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestShipped(t *testing.T) {
+	r := newReleaseHistory(t)
+	revert300 := r.revert(r.merge300, r.head)
+	revertRevert300 := r.revert(revert300, revert300)
+	r.branch("main", revertRevert300)
+	// On the staging branch, a cherry-pick that is reverted
+	cp300 := r.commit("1300: Refactor\n\n(cherry picked from commit "+r.secondParent(r.merge300).String()+")\n", r.init)
+	revertCp300 := r.revert(cp300, cp300)
+	r.branch("1.0-staging", revertCp300)
+
+	index, err := Index(r.repo, Options{CherryPicks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		issue   int
+		rev     plumbing.Hash
+		shipped bool
+	}{
+		{1100, r.init, false},
+		{1100, r.head, true},
+		{1300, r.head, true},
+		{1300, revert300, false},
+		{1300, revertRevert300, true},
+		{1300, cp300, true},
+		{1300, revertCp300, false},
+		{1400, r.head, false},
+	} {
+		commits, err := Reachable(r.repo, tc.rev.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Shipped(index[tc.issue], commits); got != tc.shipped {
+			t.Errorf("#%d at %s: expected %v, got %v", tc.issue, tc.rev, tc.shipped, got)
+		}
+	}
+}
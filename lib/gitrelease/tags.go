@@ -0,0 +1,149 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gitrelease
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Tag is a tag of the repository that is a semantic version
+type Tag struct {
+	Name    string
+	Version *semver.Version
+}
+
+// Tags returns the tags of repo of the form X.Y.Z (optionally with a "v"
+// prefix and a pre-release part, e.g. 3.0.0-rc1), sorted by version. Other
+// tags are ignored.
+func Tags(repo *git.Repository) ([]Tag, error) {
+	iter, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+	var tags []Tag
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().Short()
+		v, err := semver.NewVersion(name)
+		if err != nil {
+			return nil
+		}
+		// semver accepts "2.7" as 2.7.0, which is not a release tag
+		base := strings.SplitN(strings.SplitN(strings.TrimPrefix(name, "v"), "-", 2)[0], "+", 2)[0]
+		if strings.Count(base, ".") != 2 {
+			return nil
+		}
+		tags = append(tags, Tag{Name: name, Version: v})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].Version.LessThan(tags[j].Version)
+	})
+	return tags, nil
+}
+
+// PreviousRelease returns the tag of the release that precedes version: the
+// previous patch release on the same minor version, or for the first release
+// of a minor version, the last release of the previous one. Pre-release tags
+// (release candidates) are never returned, and the pre-release part of
+// version is ignored: the previous release of 3.0.0-rc2 is the one of 3.0.0,
+// since a release includes everything that went into its release candidates.
+func PreviousRelease(repo *git.Repository, version *semver.Version) (Tag, error) {
+	tags, err := Tags(repo)
+	if err != nil {
+		return Tag{}, err
+	}
+	release, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", version.Major(), version.Minor(), version.Patch()))
+	if err != nil {
+		return Tag{}, err
+	}
+	for i := len(tags) - 1; i >= 0; i-- {
+		if tags[i].Version.Prerelease() == "" && tags[i].Version.LessThan(release) {
+			return tags[i], nil
+		}
+	}
+	return Tag{}, fmt.Errorf("no release tag before %s", release)
+}
+
+// FirstReleases returns the first tag of each release line (X.Y) that
+// contains the changes of refs, as returned by Find (see Shipped). The tags
+// of a release line are assumed to be on a single branch, so that each one
+// contains what the previous ones contain. Lines that do not contain the
+// changes are left out. The first tag can be a pre-release tag (3.0.0-rc1),
+// in which case the changes are also in the release itself.
+func FirstReleases(repo *git.Repository, refs []IssueRef) ([]Tag, error) {
+	tags, err := Tags(repo)
+	if err != nil {
+		return nil, err
+	}
+	var lines [][]Tag
+	for i, t := range tags {
+		if i == 0 || t.Version.Major() != tags[i-1].Version.Major() || t.Version.Minor() != tags[i-1].Version.Minor() {
+			lines = append(lines, nil)
+		}
+		lines[len(lines)-1] = append(lines[len(lines)-1], t)
+	}
+	var first []Tag
+	for _, line := range lines {
+		var searchErr error
+		contains := func(i int) bool {
+			ok, err := containsChanges(repo, line[i], refs)
+			if err != nil && searchErr == nil {
+				searchErr = err
+			}
+			return ok
+		}
+		if !contains(len(line) - 1) {
+			if searchErr != nil {
+				return nil, searchErr
+			}
+			continue
+		}
+		i := sort.Search(len(line), contains)
+		if searchErr != nil {
+			return nil, searchErr
+		}
+		first = append(first, line[i])
+	}
+	return first, nil
+}
+
+// containsChanges tells whether the tag contains the changes of refs
+func containsChanges(repo *git.Repository, tag Tag, refs []IssueRef) (bool, error) {
+	head, err := Resolve(repo, "refs/tags/"+tag.Name)
+	if err != nil {
+		return false, err
+	}
+	// Walk the history of the tag once, looking for all the commits of
+	// refs
+	wanted := make(map[plumbing.Hash]bool)
+	for _, r := range refs {
+		wanted[r.Commit.Hash] = true
+	}
+	found := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(head, nil, nil).ForEach(func(c *object.Commit) error {
+		if wanted[c.Hash] {
+			found[c.Hash] = true
+			if len(found) == len(wanted) {
+				return storer.ErrStop
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return Shipped(refs, found), nil
+}
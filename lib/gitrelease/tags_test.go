@@ -0,0 +1,105 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gitrelease
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Masterminds/semver"
+)
+
+func TestTags(t *testing.T) {
+	r := newTestRepo(t)
+	c := r.commit("Initial commit\n")
+	for _, name := range []string{"2.7.1", "2.6.3", "3.0.0-rc1", "v2.7.10", "2.7.0", "3.0.0", "v2.8", "1.1.4.20180410", "latest"} {
+		r.tag(name, c)
+	}
+	tags, err := Tags(r.repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if expected := []string{"2.6.3", "2.7.0", "2.7.1", "v2.7.10", "3.0.0-rc1", "3.0.0"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestPreviousRelease(t *testing.T) {
+	r := newTestRepo(t)
+	c := r.commit("Initial commit\n")
+	for _, name := range []string{"2.6.3", "2.7.0", "2.7.1", "3.0.0-rc1", "3.0.0-rc2"} {
+		r.tag(name, c)
+	}
+	for version, expected := range map[string]string{
+		"2.7.2":     "2.7.1",
+		"2.7.1":     "2.7.0",
+		"2.7.0":     "2.6.3",
+		"2.8.0":     "2.7.1",
+		"3.0.0":     "2.7.1",
+		"3.0.0-rc2": "2.7.1",
+		"3.0.1":     "2.7.1",
+		"2.6.3":     "",
+	} {
+		tag, err := PreviousRelease(r.repo, semver.MustParse(version))
+		switch {
+		case expected == "" && err == nil:
+			t.Errorf("%s: expected an error, got %s", version, tag.Name)
+		case expected != "" && err != nil:
+			t.Errorf("%s: unexpected error %s", version, err)
+		case tag.Name != expected:
+			t.Errorf("%s: expected %q, got %q", version, expected, tag.Name)
+		}
+	}
+}
+
+func TestFirstReleases(t *testing.T) {
+	r := newReleaseHistory(t)
+	// A fix cherry-picked to the 1.0 line
+	feature200 := r.secondParent(r.merge200)
+	cp200 := r.commit("Fix things\n\n(cherry picked from commit "+feature200.String()+")\n", r.init)
+	r.branch("1.0-staging", cp200)
+	r.tag("1.0.1", cp200)
+	// 1300 is reverted before the first release candidate of 1.2, and
+	// merged again for the release
+	revert300 := r.revert(r.merge300, r.head)
+	r.tag("1.2.0-rc1", revert300)
+	again := r.commit("1300: Refactor, take two\n", revert300)
+	merge300 := r.commit("Merge branch '1300-refactor-again'\n\nrefs #1300\n", revert300, again)
+	r.tag("1.2.0", merge300)
+	// 1100 is reverted before the first release candidate of 1.3, and the
+	// revert is reverted for the release
+	revert100 := r.revert(r.merge100, merge300)
+	r.tag("1.3.0-rc1", revert100)
+	revertRevert100 := r.revert(revert100, revert100)
+	r.branch("main", revertRevert100)
+	r.tag("1.3.0", revertRevert100)
+
+	for issue, expected := range map[int][]string{
+		1100: {"1.1.0", "1.2.0-rc1", "1.3.0"},
+		1200: {"1.0.1", "1.1.0", "1.2.0-rc1", "1.3.0-rc1"},
+		1300: {"1.1.0", "1.2.0", "1.3.0-rc1"},
+		1999: nil,
+	} {
+		refs, err := Find(r.repo, issue, Options{CherryPicks: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, err := FirstReleases(r.repo, refs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("#%d: expected %v, got %v", issue, expected, names)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package issuequery implements a compact query syntax for selecting Redmine
+// issues, e.g.
+//
+//	status:open tracker:Bug release:"Arvados 2.7.1" assignee:me updated:>2w
+//
+// A query is a list of key:value terms separated by spaces. Values that
+// contain spaces must be quoted. Words without a key are matched against
+// the issue subject. The supported keys are:
+//
+//	project   project identifier, name or ID
+//	status    open, closed, * (any), or status names or IDs
+//	tracker   tracker names or IDs
+//	release   release name or ID, or none
+//	sprint    sprint (version) name or ID, or none
+//	assignee  me, none, or the name or ID of a project member
+//	parent    parent issue ID, or none
+//	subject   text contained in the subject
+//	updated   date (YYYY-MM-DD) or period (e.g. 3d, 2w, 6m, 1y) of the last update
+//	query     name or ID of a saved Redmine query
+//
+// Several names or IDs can be given separated by commas, meaning any of
+// them. Most terms can be negated with a leading "-" (e.g. -tracker:Support).
+// Dates can be preceded by > or < (or >=, <=): updated:>2w selects issues
+// updated within the last two weeks, updated:<2024-01-31 issues last updated
+// on or before that date.
+package issuequery
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+)
+
+// Term is a single key:value element of a query
+type Term struct {
+	Key    string
+	Op     string // "", ">", ">=", "<" or "<="
+	Value  string
+	Negate bool
+}
+
+// Resolver converts names into the IDs Redmine issue filters expect. It is
+// implemented by *redmine.Client.
+type Resolver interface {
+	ResolveProject(name string) (string, error)
+	ResolveStatus(name string) (string, error)
+	ResolveTracker(name string) (string, error)
+	ResolveRelease(project, name string) (string, error)
+	ResolveSprint(project, name string) (string, error)
+	ResolveUser(project, name string) (string, error)
+	ResolveQuery(name string) (string, error)
+}
+
+var keys = map[string]bool{
+	"project":  true,
+	"status":   true,
+	"tracker":  true,
+	"release":  true,
+	"sprint":   true,
+	"assignee": true,
+	"parent":   true,
+	"subject":  true,
+	"updated":  true,
+	"query":    true,
+}
+
+// Parse splits a query into terms. Words without a key are joined into a
+// single subject term.
+func Parse(q string) ([]Term, error) {
+	var terms []Term
+	var words []string
+	seen := make(map[string]bool)
+	for _, tok := range tokenize(q) {
+		if tok.err != nil {
+			return nil, tok.err
+		}
+		if !tok.hasKey {
+			words = append(words, tok.text)
+			continue
+		}
+		t := Term{Key: strings.ToLower(tok.key), Value: tok.text}
+		if strings.HasPrefix(t.Key, "-") {
+			t.Negate = true
+			t.Key = t.Key[1:]
+		}
+		if !keys[t.Key] {
+			return nil, fmt.Errorf("unknown key '%s' in query", t.Key)
+		}
+		if seen[t.Key] {
+			return nil, fmt.Errorf("key '%s' is used more than once in query", t.Key)
+		}
+		seen[t.Key] = true
+		for _, op := range []string{">=", "<=", ">", "<"} {
+			if !tok.quoted && strings.HasPrefix(t.Value, op) {
+				t.Op = op
+				t.Value = t.Value[len(op):]
+				break
+			}
+		}
+		if t.Op != "" && t.Key != "updated" {
+			return nil, fmt.Errorf("operator %s is only supported for dates", t.Op)
+		}
+		if t.Negate && (t.Key == "project" || t.Key == "updated" || t.Key == "subject" || t.Key == "query") {
+			return nil, fmt.Errorf("'%s' can not be negated", t.Key)
+		}
+		if t.Value == "" {
+			return nil, fmt.Errorf("missing value for '%s'", t.Key)
+		}
+		terms = append(terms, t)
+	}
+	if len(words) > 0 {
+		if seen["subject"] {
+			return nil, fmt.Errorf("key 'subject' is used more than once in query")
+		}
+		terms = append(terms, Term{Key: "subject", Value: strings.Join(words, " ")})
+	}
+	return terms, nil
+}
+
+type token struct {
+	key    string
+	hasKey bool
+	text   string
+	quoted bool
+	err    error
+}
+
+// tokenize splits q at spaces that are not inside double quotes. The key is
+// the part before the first colon outside quotes.
+func tokenize(q string) []token {
+	var tokens []token
+	var cur token
+	var buf strings.Builder
+	inQuotes, inToken := false, false
+	flush := func() {
+		if inToken {
+			cur.text = buf.String()
+			tokens = append(tokens, cur)
+		}
+		cur = token{}
+		buf.Reset()
+		inToken = false
+	}
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			inToken = true
+			cur.quoted = true
+		case inQuotes:
+			buf.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == ':' && !cur.hasKey && buf.Len() > 0:
+			cur.key = buf.String()
+			cur.hasKey = true
+			buf.Reset()
+		default:
+			buf.WriteRune(r)
+			inToken = true
+		}
+	}
+	if inQuotes {
+		return append(tokens, token{err: fmt.Errorf("unterminated quote in query")})
+	}
+	flush()
+	return tokens
+}
+
+// Apply parses the query q and sets the corresponding fields of f, resolving
+// names with r. Fields that the query does not mention are left unchanged,
+// so f can hold defaults. Relative dates are relative to now.
+func Apply(f *redmine.IssueFilter, q string, r Resolver, now time.Time) error {
+	terms, err := Parse(q)
+	if err != nil {
+		return err
+	}
+	// Release, sprint and user names are looked up in the project, so
+	// resolve it first
+	for _, t := range terms {
+		if t.Key == "project" {
+			f.ProjectID, err = r.ResolveProject(t.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range terms {
+		var v string
+		switch t.Key {
+		case "status":
+			v, err = r.ResolveStatus(t.Value)
+			f.StatusID = negate(t, v)
+		case "tracker":
+			v, err = r.ResolveTracker(t.Value)
+			f.TrackerID = negate(t, v)
+		case "release":
+			v, err = special(t.Value, func(name string) (string, error) { return r.ResolveRelease(f.ProjectID, name) })
+			f.ReleaseID = negate(t, v)
+		case "sprint":
+			v, err = special(t.Value, func(name string) (string, error) { return r.ResolveSprint(f.ProjectID, name) })
+			f.VersionID = negate(t, v)
+		case "assignee":
+			v, err = special(t.Value, func(name string) (string, error) { return r.ResolveUser(f.ProjectID, name) })
+			f.AssignedToID = negate(t, v)
+		case "parent":
+			v, err = special(t.Value, func(id string) (string, error) {
+				_, err := strconv.Atoi(strings.TrimPrefix(id, "#"))
+				if err != nil {
+					return "", fmt.Errorf("invalid parent issue ID '%s'", id)
+				}
+				return strings.TrimPrefix(id, "#"), nil
+			})
+			f.ParentID = negate(t, v)
+		case "subject":
+			f.Subject = url.QueryEscape(t.Value)
+		case "updated":
+			var date string
+			date, err = RelativeDate(t.Value, now)
+			switch t.Op {
+			case "":
+				f.UpdatedOn = "=" + date
+			case ">", ">=":
+				f.UpdatedOn = ">=" + date
+			case "<", "<=":
+				f.UpdatedOn = "<=" + date
+			}
+		case "query":
+			f.QueryID, err = r.ResolveQuery(t.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// special handles the values that mean "not set" and "set to anything",
+// and resolves anything else with resolve.
+func special(value string, resolve func(string) (string, error)) (string, error) {
+	switch strings.ToLower(value) {
+	case "none", "!*":
+		return "!*", nil
+	case "any", "*":
+		return "*", nil
+	}
+	return resolve(value)
+}
+
+// negate applies the "!" (is not) operator of Redmine filters to value if the
+// term is negated. The special values are swapped with their opposites
+// instead: "!*" (none) and "*" (any), "open" and "closed".
+func negate(t Term, value string) string {
+	if !t.Negate {
+		return value
+	}
+	switch value {
+	case "!*":
+		return "*"
+	case "*":
+		return "!*"
+	case "open":
+		return "closed"
+	case "closed":
+		return "open"
+	}
+	return "!" + value
+}
+
+var reRelativeDate = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// RelativeDate converts a date (YYYY-MM-DD) or a period before now (e.g. 2w
+// for two weeks ago) into a date.
+func RelativeDate(s string, now time.Time) (string, error) {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return s, nil
+	}
+	m := reRelativeDate.FindStringSubmatch(s)
+	if m == nil {
+		return "", fmt.Errorf("invalid date '%s': expecting YYYY-MM-DD or a number followed by d, w, m or y", s)
+	}
+	n, _ := strconv.Atoi(m[1])
+	switch m[2] {
+	case "d":
+		now = now.AddDate(0, 0, -n)
+	case "w":
+		now = now.AddDate(0, 0, -7*n)
+	case "m":
+		now = now.AddDate(0, -n, 0)
+	case "y":
+		now = now.AddDate(-n, 0, 0)
+	}
+	return now.Format("2006-01-02"), nil
+}
@@ -0,0 +1,150 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package issuequery
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"git.arvados.org/arvados-dev.git/lib/redmine"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		terms []Term
+		err   string
+	}{
+		{query: "", terms: nil},
+		{query: "status:open", terms: []Term{{Key: "status", Value: "open"}}},
+		{query: "Status:open  tracker:Bug", terms: []Term{{Key: "status", Value: "open"}, {Key: "tracker", Value: "Bug"}}},
+		{query: `release:"Arvados 2.7.1"`, terms: []Term{{Key: "release", Value: "Arvados 2.7.1"}}},
+		{query: `subject:"café au lait"`, terms: []Term{{Key: "subject", Value: "café au lait"}}},
+		{query: "-tracker:Support", terms: []Term{{Key: "tracker", Value: "Support", Negate: true}}},
+		{query: "updated:>2w", terms: []Term{{Key: "updated", Op: ">", Value: "2w"}}},
+		{query: "updated:<=2024-01-31", terms: []Term{{Key: "updated", Op: "<=", Value: "2024-01-31"}}},
+		{query: "crash on start status:open", terms: []Term{{Key: "status", Value: "open"}, {Key: "subject", Value: "crash on start"}}},
+		{query: "release:a:b", terms: []Term{{Key: "release", Value: "a:b"}}},
+		{query: "color:red", err: "unknown key 'color' in query"},
+		{query: "status:open status:closed", err: "key 'status' is used more than once in query"},
+		{query: "subject:foo bar", err: "key 'subject' is used more than once in query"},
+		{query: "tracker:>Bug", err: "operator > is only supported for dates"},
+		{query: "-updated:2w", err: "'updated' can not be negated"},
+		{query: "-project:arvados", err: "'project' can not be negated"},
+		{query: "status:", err: "missing value for 'status'"},
+		{query: `subject:"foo`, err: "unterminated quote in query"},
+		{query: `subject:"café`, err: "unterminated quote in query"},
+		{query: `"é`, err: "unterminated quote in query"},
+	} {
+		terms, err := Parse(tc.query)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("Parse(%q): expected error %q, got %v", tc.query, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): unexpected error %s", tc.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(terms, tc.terms) {
+			t.Errorf("Parse(%q): expected %+v, got %+v", tc.query, tc.terms, terms)
+		}
+	}
+}
+
+func TestRelativeDate(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		in, out string
+		err     bool
+	}{
+		{in: "2024-01-31", out: "2024-01-31"},
+		{in: "0d", out: "2024-03-31"},
+		{in: "3d", out: "2024-03-28"},
+		{in: "2w", out: "2024-03-17"},
+		{in: "1m", out: "2024-03-02"},
+		{in: "1y", out: "2023-03-31"},
+		{in: "2024-13-01", err: true},
+		{in: "3h", err: true},
+		{in: "-3d", err: true},
+		{in: "", err: true},
+	} {
+		out, err := RelativeDate(tc.in, now)
+		switch {
+		case tc.err && err == nil:
+			t.Errorf("RelativeDate(%q): expected an error, got %q", tc.in, out)
+		case !tc.err && err != nil:
+			t.Errorf("RelativeDate(%q): unexpected error %s", tc.in, err)
+		case out != tc.out:
+			t.Errorf("RelativeDate(%q): expected %q, got %q", tc.in, tc.out, out)
+		}
+	}
+}
+
+// fakeResolver resolves names by prefixing them with the kind of object
+type fakeResolver struct{}
+
+func (fakeResolver) ResolveProject(name string) (string, error) { return "p-" + name, nil }
+func (fakeResolver) ResolveStatus(name string) (string, error) {
+	if name == "open" || name == "closed" || name == "*" {
+		return name, nil
+	}
+	return "s-" + name, nil
+}
+func (fakeResolver) ResolveTracker(name string) (string, error) { return "t-" + name, nil }
+func (fakeResolver) ResolveRelease(project, name string) (string, error) {
+	return fmt.Sprintf("r-%s-%s", project, name), nil
+}
+func (fakeResolver) ResolveSprint(project, name string) (string, error) {
+	return fmt.Sprintf("v-%s-%s", project, name), nil
+}
+func (fakeResolver) ResolveUser(project, name string) (string, error) {
+	if name == "me" {
+		return "me", nil
+	}
+	return fmt.Sprintf("u-%s-%s", project, name), nil
+}
+func (fakeResolver) ResolveQuery(name string) (string, error) { return "q-" + name, nil }
+
+func TestApply(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		query  string
+		filter redmine.IssueFilter
+	}{
+		{query: "status:open", filter: redmine.IssueFilter{StatusID: "open"}},
+		{query: "-status:open", filter: redmine.IssueFilter{StatusID: "closed"}},
+		{query: "-status:Resolved", filter: redmine.IssueFilter{StatusID: "!s-Resolved"}},
+		{query: "-tracker:Support", filter: redmine.IssueFilter{TrackerID: "!t-Support"}},
+		{query: "release:none", filter: redmine.IssueFilter{ReleaseID: "!*"}},
+		{query: "-release:none", filter: redmine.IssueFilter{ReleaseID: "*"}},
+		{query: "-sprint:any", filter: redmine.IssueFilter{VersionID: "!*"}},
+		{query: `sprint:"May 1" project:arvados`, filter: redmine.IssueFilter{ProjectID: "p-arvados", VersionID: "v-p-arvados-May 1"}},
+		{query: "assignee:me parent:#12", filter: redmine.IssueFilter{AssignedToID: "me", ParentID: "12"}},
+		{query: "updated:2w", filter: redmine.IssueFilter{UpdatedOn: "=2024-03-17"}},
+		{query: "updated:>2w", filter: redmine.IssueFilter{UpdatedOn: ">=2024-03-17"}},
+		{query: "updated:<2024-01-31", filter: redmine.IssueFilter{UpdatedOn: "<=2024-01-31"}},
+		{query: "crash on start", filter: redmine.IssueFilter{Subject: "crash+on+start"}},
+		{query: "query:Mine", filter: redmine.IssueFilter{QueryID: "q-Mine"}},
+	} {
+		var f redmine.IssueFilter
+		err := Apply(&f, tc.query, fakeResolver{}, now)
+		if err != nil {
+			t.Errorf("Apply(%q): unexpected error %s", tc.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(f, tc.filter) {
+			t.Errorf("Apply(%q): expected %+v, got %+v", tc.query, tc.filter, f)
+		}
+	}
+
+	var f redmine.IssueFilter
+	if err := Apply(&f, "parent:abc", fakeResolver{}, now); err == nil {
+		t.Errorf("Apply(parent:abc): expected an error")
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package output renders command results in the format selected by the user
+// with the --output flag.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Human is free-form text meant to be read by people. Records that
+	// do not implement fmt.Stringer are rendered as a table.
+	Human = ""
+	// JSON is a single (indented) JSON document. Records are collected into
+	// an array that is written by Flush.
+	JSON = "json"
+	// JSONLine writes one compact JSON document per line
+	JSONLine = "json-line"
+	// Table is an aligned plain text table, one row per record
+	Table = "table"
+	// CSV has a header line followed by one line per record
+	CSV = "csv"
+	// Markdown is a table in GitHub flavored markdown
+	Markdown = "markdown"
+	// YAML is a single YAML document. Like JSON, records are collected into
+	// a sequence that is written by Flush.
+	YAML = "yaml"
+)
+
+// Formats lists all supported output formats
+var Formats = []string{JSON, JSONLine, Table, CSV, Markdown, YAML}
+
+// Printer writes command results to an io.Writer. Commands report each
+// result with Record (or Object, for commands that produce a single result)
+// and call Flush when done. Progress messages go through Infof, which keeps
+// them out of the way of structured output.
+type Printer struct {
+	w       io.Writer
+	info    io.Writer
+	format  string
+	columns []string
+	records []interface{}
+	flushed bool // the list of records was written (JSON and YAML)
+	mtx     sync.Mutex
+}
+
+// New returns a Printer that writes to w in the given format
+func New(w io.Writer, format string) (*Printer, error) {
+	p := &Printer{w: w, info: w, format: format}
+	if format == Human {
+		return p, nil
+	}
+	for _, f := range Formats {
+		if f == format {
+			p.info = os.Stderr
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown output format '%s'", format)
+}
+
+// SetColumns limits the output to the given fields of each record, in the
+// given order. Field names are the JSON names of the record fields.
+func (p *Printer) SetColumns(columns []string) {
+	p.columns = columns
+}
+
+// Structured reports whether the output is meant to be read by programs
+func (p *Printer) Structured() bool {
+	return p.format != Human
+}
+
+// Info returns the writer for progress messages and prompts. It is stderr
+// for structured formats, so that stdout only contains results.
+func (p *Printer) Info() io.Writer {
+	return p.info
+}
+
+// Infof prints a progress message
+func (p *Printer) Infof(format string, a ...interface{}) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	fmt.Fprintf(p.info, format, a...)
+}
+
+// Record prints one result. Formats that need to see all records before
+// writing anything (JSON, YAML and the tabular formats) buffer it until
+// Flush is called.
+func (p *Printer) Record(v interface{}) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	switch p.format {
+	case JSONLine:
+		v, err := p.selectColumns(v)
+		if err != nil {
+			return err
+		}
+		return p.writeJSON(v, false)
+	case Human:
+		if s, ok := v.(fmt.Stringer); ok {
+			_, err := fmt.Fprintln(p.w, s.String())
+			return err
+		}
+	}
+	p.records = append(p.records, v)
+	return nil
+}
+
+// Object prints the single result of a command. In the tabular formats, it
+// is rendered as a table of field names and values. In human-readable
+// output, values that implement fmt.Stringer are printed as text.
+func (p *Printer) Object(v interface{}) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if s, ok := v.(fmt.Stringer); ok && p.format == Human {
+		_, err := fmt.Fprintln(p.w, s.String())
+		return err
+	}
+	v, err := p.selectColumns(v)
+	if err != nil {
+		return err
+	}
+	switch p.format {
+	case Table, CSV, Markdown:
+		o, err := toOrdered(v)
+		if err != nil {
+			return err
+		}
+		obj, ok := o.(object)
+		if !ok {
+			return p.writeTable([]string{"field", "value"}, [][]string{{"value", cell(o)}})
+		}
+		var rows [][]string
+		for _, f := range obj {
+			rows = append(rows, []string{f.Name, cell(f.Value)})
+		}
+		return p.writeTable([]string{"field", "value"}, rows)
+	case YAML:
+		return p.writeYAML(v)
+	}
+	return p.writeJSON(v, p.format != JSONLine)
+}
+
+// Flush writes any buffered records. In JSON and YAML, the records form a
+// single list, so only the first call writes anything: a command can flush
+// before printing a summary and still defer Flush.
+func (p *Printer) Flush() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	records := p.records
+	p.records = nil
+	switch p.format {
+	case JSON, YAML:
+		if p.flushed {
+			return nil
+		}
+		p.flushed = true
+		list := []interface{}{}
+		for _, r := range records {
+			r, err := p.selectColumns(r)
+			if err != nil {
+				return err
+			}
+			list = append(list, r)
+		}
+		if p.format == YAML {
+			return p.writeYAML(list)
+		}
+		return p.writeJSON(list, true)
+	case Human, Table, CSV, Markdown:
+		if len(records) == 0 {
+			return nil
+		}
+		columns, rows, err := p.tabulate(records)
+		if err != nil {
+			return err
+		}
+		return p.writeTable(columns, rows)
+	}
+	return nil
+}
+
+func (p *Printer) writeJSON(v interface{}, indent bool) error {
+	enc := json.NewEncoder(p.w)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+func (p *Printer) writeYAML(v interface{}) error {
+	v, err := toOrdered(v)
+	if err != nil {
+		return err
+	}
+	buf, err := yaml.Marshal(yamlValue(v))
+	if err != nil {
+		return err
+	}
+	_, err = p.w.Write(buf)
+	return err
+}
+
+// selectColumns returns v as an ordered object limited to the selected
+// columns. If no columns are selected, v is returned unchanged.
+func (p *Printer) selectColumns(v interface{}) (interface{}, error) {
+	if len(p.columns) == 0 {
+		return v, nil
+	}
+	o, err := toOrdered(v)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := o.(object)
+	if !ok {
+		return v, nil
+	}
+	var selected object
+	for _, c := range p.columns {
+		selected = append(selected, field{c, obj.get(c)})
+	}
+	return selected, nil
+}
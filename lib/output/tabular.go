@@ -0,0 +1,220 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// field is a member of an object
+type field struct {
+	Name  string
+	Value interface{}
+}
+
+// object is a JSON object that remembers the order of its fields, so that
+// columns come out in the order the record type declares them.
+type object []field
+
+func (o object) get(name string) interface{} {
+	for _, f := range o {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// toOrdered converts v to its JSON representation, decoded into objects,
+// []interface{} and scalar values (with numbers as json.Number).
+func toOrdered(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	return decodeOrdered(dec)
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, field{k.(string), v})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// tabulate converts records into rows of cells. Without selected columns,
+// the columns are all the fields found in the records, in the order they
+// were first seen.
+func (p *Printer) tabulate(records []interface{}) ([]string, [][]string, error) {
+	var objects []object
+	columns := p.columns
+	seen := make(map[string]bool)
+	for _, r := range records {
+		o, err := toOrdered(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		obj, ok := o.(object)
+		if !ok {
+			obj = object{{"value", o}}
+		}
+		objects = append(objects, obj)
+		if len(p.columns) > 0 {
+			continue
+		}
+		for _, f := range obj {
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				columns = append(columns, f.Name)
+			}
+		}
+	}
+	var rows [][]string
+	for _, obj := range objects {
+		var row []string
+		for _, c := range columns {
+			row = append(row, cell(obj.get(c)))
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// cell renders a value as the text of a table cell. Nested objects are
+// shown by name where they have one (e.g. the status of an issue).
+func cell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	case object:
+		for _, k := range []string{"name", "id"} {
+			if x := v.get(k); x != nil {
+				return cell(x)
+			}
+		}
+		buf, _ := json.Marshal(v)
+		return string(buf)
+	case []interface{}:
+		var cells []string
+		for _, x := range v {
+			cells = append(cells, cell(x))
+		}
+		return strings.Join(cells, ", ")
+	}
+	o, err := toOrdered(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return cell(o)
+}
+
+func (p *Printer) writeTable(columns []string, rows [][]string) error {
+	switch p.format {
+	case CSV:
+		w := csv.NewWriter(p.w)
+		w.Write(columns)
+		w.WriteAll(rows)
+		return w.Error()
+	case Markdown:
+		esc := func(cells []string) string {
+			var out []string
+			for _, c := range cells {
+				c = strings.ReplaceAll(c, "|", "\\|")
+				c = strings.ReplaceAll(c, "\n", " ")
+				out = append(out, c)
+			}
+			return "| " + strings.Join(out, " | ") + " |\n"
+		}
+		var sep []string
+		for range columns {
+			sep = append(sep, "---")
+		}
+		fmt.Fprint(p.w, esc(columns))
+		fmt.Fprint(p.w, "|"+strings.Join(sep, "|")+"|\n")
+		for _, row := range rows {
+			fmt.Fprint(p.w, esc(row))
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	var header []string
+	for _, c := range columns {
+		header = append(header, strings.ToUpper(c))
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		for i, c := range row {
+			// Keep multi-line values from breaking the alignment
+			row[i] = strings.ReplaceAll(c, "\n", " ")
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
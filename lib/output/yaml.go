@@ -0,0 +1,39 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package output
+
+import (
+	"encoding/json"
+
+	"gopkg.in/yaml.v2"
+)
+
+// yamlValue converts the result of toOrdered into values the yaml package
+// renders with the field order and number types preserved.
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case object:
+		m := yaml.MapSlice{}
+		for _, f := range v {
+			m = append(m, yaml.MapItem{Key: f.Name, Value: yamlValue(f.Value)})
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, x := range v {
+			list[i] = yamlValue(x)
+		}
+		return list
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package parallel runs independent jobs, such as Redmine updates, on a
+// bounded number of goroutines.
+package parallel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultParallelism is the number of concurrent jobs used when the
+// Executor does not set one
+const DefaultParallelism = 8
+
+// ErrSkipped is the error reported for the jobs that were not started
+// because the error budget was exhausted
+var ErrSkipped = errors.New("skipped: too many errors")
+
+// Executor runs jobs concurrently
+type Executor struct {
+	// Parallelism is the maximum number of jobs running at the same time
+	// (DefaultParallelism if zero)
+	Parallelism int
+	// MaxErrors is the error budget: once that many jobs have failed, the
+	// jobs that have not started yet are skipped. Zero means no limit.
+	MaxErrors int
+}
+
+// BudgetError is returned by Run when jobs were skipped because the error
+// budget was exhausted
+type BudgetError struct {
+	Failed  int
+	Skipped int
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%d job(s) failed, %d skipped", e.Failed, e.Skipped)
+}
+
+// Run calls job(i) for every i from 0 to n-1 and waits for them to finish.
+// The returned slice holds the error of each job: nil on success, ErrSkipped
+// for the jobs that were not started. The error is a *BudgetError if any
+// jobs were skipped.
+func (e Executor) Run(n int, job func(i int) error) ([]error, error) {
+	workers := e.Parallelism
+	if workers <= 0 {
+		workers = DefaultParallelism
+	}
+	if n < workers {
+		workers = n
+	}
+	errs := make([]error, n)
+	var mtx sync.Mutex
+	failed := 0
+	exhausted := func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return e.MaxErrors > 0 && failed >= e.MaxErrors
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if exhausted() {
+					errs[i] = ErrSkipped
+					continue
+				}
+				err := job(i)
+				if err != nil {
+					mtx.Lock()
+					failed++
+					mtx.Unlock()
+				}
+				errs[i] = err
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	skipped := 0
+	for _, err := range errs {
+		if err == ErrSkipped {
+			skipped++
+		}
+	}
+	if skipped > 0 {
+		return errs, &BudgetError{Failed: failed, Skipped: skipped}
+	}
+	return errs, nil
+}
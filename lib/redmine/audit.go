@@ -0,0 +1,241 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Change is the before and after value of a single field. Field names are
+// the ones used in Redmine API update requests (e.g. release_id).
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry records a single mutation made through the client
+type AuditEntry struct {
+	Run      string    `json:"run"`
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Endpoint string    `json:"endpoint"`
+	Command  string    `json:"command,omitempty"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Object   string    `json:"object"`
+	ObjectID int       `json:"object_id,omitempty"`
+	Action   string    `json:"action"`
+	Changes  []Change  `json:"changes,omitempty"`
+}
+
+// AuditLog appends an AuditEntry for every mutation to a JSON-lines file.
+// All entries written through one AuditLog share the same run ID.
+type AuditLog struct {
+	Path    string
+	Run     string
+	Command string
+	mtx     sync.Mutex
+}
+
+// NewAuditLog returns an AuditLog that appends to the file at path, using a
+// new unique run ID.
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{Path: path, Run: NewRunID()}
+}
+
+// NewRunID returns a new run ID. Run IDs sort in chronological order.
+func NewRunID() string {
+	buf := make([]byte, 3)
+	rand.Read(buf)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(buf)
+}
+
+// DefaultAuditLogPath returns the default location of the audit log,
+// following the XDG base directory specification for state files.
+func DefaultAuditLogPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "arvados-dev", "audit.jsonl")
+}
+
+func (a *AuditLog) append(e AuditEntry) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	e.Run = a.Run
+	e.Command = a.Command
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(a.Path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(buf, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadAuditLog returns all entries in the audit log at path, oldest first
+func ReadAuditLog(path string) ([]AuditEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// SetAuditLog makes the client record every mutation in a. Mutations that
+// are intercepted by DryRun are not recorded.
+func (c *Client) SetAuditLog(a *AuditLog) {
+	c.audit = a
+}
+
+func (c *Client) auditing() bool {
+	return c.audit != nil && !c.dryRun
+}
+
+// auditUser returns the login of the redmine user the client acts as,
+// falling back to the local user name.
+func (c *Client) auditUser() string {
+	c.userOnce.Do(func() {
+		u, err := c.CurrentUser()
+		if err == nil && u.Login != "" {
+			c.user = u.Login
+		} else {
+			c.user = os.Getenv("USER")
+		}
+	})
+	return c.user
+}
+
+func (c *Client) record(e AuditEntry) error {
+	if !c.auditing() {
+		return nil
+	}
+	e.Time = time.Now().UTC()
+	e.User = c.auditUser()
+	e.Endpoint = c.endpoint
+	err := c.audit.append(e)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %s", err)
+	}
+	return nil
+}
+
+// IssueFields returns the updatable fields of issue that have a value, keyed
+// by the names Redmine expects in update requests. Both the ID fields and
+// the embedded objects returned by read operations are taken into account.
+func IssueFields(issue Issue) map[string]interface{} {
+	f := make(map[string]interface{})
+	set := func(name string, v interface{}) {
+		switch v := v.(type) {
+		case int:
+			if v == 0 {
+				return
+			}
+		case string:
+			if v == "" {
+				return
+			}
+		case float64:
+			if v == 0 {
+				return
+			}
+		}
+		f[name] = v
+	}
+	set("subject", issue.Subject)
+	set("description", issue.Description)
+	set("project_id", idOf(issue.ProjectID, issue.Project))
+	set("status_id", idOf(issue.StatusID, issue.Status))
+	set("fixed_version_id", idOf(issue.FixedVersionID, issue.FixedVersion))
+	set("tracker_id", idOf(issue.TrackerID, issue.Tracker))
+	set("priority_id", idOf(issue.PriorityID, issue.Priority))
+	set("category_id", idOf(issue.CategoryID, issue.Category))
+	set("assigned_to_id", idOf(issue.AssignedToID, issue.AssignedTo))
+	set("estimated_hours", issue.EstimatedHours)
+	parent := issue.ParentIssueID
+	if parent == 0 && issue.Parent != nil {
+		parent = issue.Parent.ID
+	}
+	set("parent_issue_id", parent)
+	release := issue.ReleaseID
+	if release == 0 && issue.Release != nil && issue.Release["release"] != nil {
+		release = issue.Release["release"].ID
+	}
+	set("release_id", release)
+	return f
+}
+
+func idOf(id int, obj *IDName) int {
+	if id == 0 && obj != nil {
+		return obj.ID
+	}
+	return id
+}
+
+// SameValue reports whether two field values are equal. Values read back from
+// the audit log are decoded from JSON, so numbers are compared by their
+// string representation.
+func SameValue(a, b interface{}) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// fieldChanges returns the changes between before and the given new field
+// values, ignoring fields that are not modified.
+func fieldChanges(before, after map[string]interface{}) []Change {
+	var changes []Change
+	for k, v := range after {
+		if !SameValue(before[k], v) {
+			changes = append(changes, Change{Field: k, Before: before[k], After: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
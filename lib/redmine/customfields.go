@@ -0,0 +1,77 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+import (
+	"fmt"
+)
+
+// CustomField is the definition of a custom field
+type CustomField struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	CustomizedType string `json:"customized_type"` // e.g. "issue"
+	FieldFormat    string `json:"field_format"`    // e.g. "string", "list", "bool"
+	Multiple       bool   `json:"multiple"`
+}
+
+// CustomFieldValue is the value of a custom field of an issue. Value is a
+// string, or a list of strings for fields with multiple values.
+type CustomFieldValue struct {
+	ID       int         `json:"id"`
+	Name     string      `json:"name,omitempty"`
+	Multiple bool        `json:"multiple,omitempty"`
+	Value    interface{} `json:"value"`
+}
+
+// Values returns the non-empty values of the field
+func (v CustomFieldValue) Values() []string {
+	var values []string
+	switch value := v.Value.(type) {
+	case string:
+		if value != "" {
+			values = append(values, value)
+		}
+	case []interface{}:
+		for _, e := range value {
+			if s, ok := e.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// CustomField returns the value of the custom field named name (or with that
+// ID), or nil if the issue does not have it
+func (i *Issue) CustomField(name string) *CustomFieldValue {
+	for k, f := range i.CustomFields {
+		if f.Name == name || fmt.Sprint(f.ID) == name {
+			return &i.CustomFields[k]
+		}
+	}
+	return nil
+}
+
+type customFieldsResult struct {
+	CustomFields []CustomField `json:"custom_fields"`
+}
+
+// CustomFields returns the definitions of all custom fields. Redmine only
+// allows administrators to list them.
+func (c *Client) CustomFields() ([]CustomField, error) {
+	res, err := c.Get("/custom_fields.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var r customFieldsResult
+	err = responseHelper(res, &r, 200)
+	if err != nil {
+		return nil, err
+	}
+	return r.CustomFields, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// debugTransport is an http.RoundTripper that logs every request and the
+// status of its response. API keys are redacted from the log.
+type debugTransport struct {
+	base http.RoundTripper
+	w    io.Writer
+	mtx  sync.Mutex
+}
+
+const redacted = "[redacted]"
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mtx.Lock()
+	fmt.Fprintf(t.w, "[debug] > %s %s\n", req.Method, redactURL(req.URL))
+	var names []string
+	for k := range req.Header {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		for _, v := range req.Header[k] {
+			if http.CanonicalHeaderKey(k) == "X-Redmine-Api-Key" {
+				v = redacted
+			}
+			fmt.Fprintf(t.w, "[debug] > %s: %s\n", k, v)
+		}
+	}
+	t.mtx.Unlock()
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if err != nil {
+		fmt.Fprintf(t.w, "[debug] < %s %s: error: %s\n", req.Method, redactURL(req.URL), err)
+		return res, err
+	}
+	fmt.Fprintf(t.w, "[debug] < %s %s: %s (%s)\n", req.Method, redactURL(req.URL), res.Status, time.Since(start).Round(time.Millisecond))
+	return res, err
+}
+
+// redactURL returns u with the API key (which Redmine also accepts as the
+// "key" query parameter) and any password removed.
+func redactURL(u *url.URL) string {
+	r := *u
+	if r.User != nil {
+		r.User = url.User(r.User.Username())
+	}
+	q := r.Query()
+	if q.Get("key") != "" {
+		q.Set("key", redacted)
+		r.RawQuery = q.Encode()
+	}
+	return r.String()
+}
+
+// Debug makes the client log every request it makes to w
+func (c *Client) Debug(w io.Writer) {
+	base := c.Client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Client = &http.Client{
+		Transport: &debugTransport{base: base, w: w},
+		Timeout:   c.Client.Timeout,
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// dryRunTransport is an http.RoundTripper that passes read-only requests
+// through to the wrapped transport and intercepts everything else.
+// Intercepted requests are printed and answered with a synthesized response,
+// so that commands that make several dependent calls can run to completion
+// without changing anything on the server.
+type dryRunTransport struct {
+	base   http.RoundTripper
+	w      io.Writer
+	mtx    sync.Mutex
+	nextID int
+}
+
+// Synthesized objects get IDs from this range, which is well above anything
+// our Redmine instances will reach.
+const dryRunFirstID = 900000000
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "GET" || req.Method == "HEAD" {
+		return t.base.RoundTrip(req)
+	}
+
+	var payload []byte
+	if req.Body != nil {
+		var err error
+		payload, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	fmt.Fprintf(t.w, "[dry-run] %s %s\n", req.Method, req.URL.RequestURI())
+	if len(payload) > 0 {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, payload, "", "  ") == nil {
+			payload = pretty.Bytes()
+		}
+		fmt.Fprintf(t.w, "%s\n", payload)
+	}
+
+	if req.Method != "POST" {
+		// Redmine answers updates and deletes with an empty body
+		return t.response(req, http.StatusNoContent, nil), nil
+	}
+	t.nextID++
+	return t.response(req, http.StatusCreated, synthesizeCreated(payload, t.nextID)), nil
+}
+
+func (t *dryRunTransport) response(req *http.Request, code int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// synthesizeCreated builds a plausible response to a create request. The
+// Redmine API wraps objects in a single key (e.g. {"issue": {...}}); the
+// created object is echoed back with an ID, and foo_id fields are also
+// expanded into the foo: {"id": N} form that read operations return.
+func synthesizeCreated(payload []byte, id int) []byte {
+	var req map[string]map[string]interface{}
+	if json.Unmarshal(payload, &req) != nil || len(req) != 1 {
+		return []byte("{}")
+	}
+	for kind, obj := range req {
+		obj["id"] = dryRunFirstID + id
+		for k, v := range obj {
+			if !strings.HasSuffix(k, "_id") {
+				continue
+			}
+			name := strings.TrimSuffix(k, "_id")
+			if name == "parent_issue" {
+				name = "parent"
+			}
+			if _, ok := obj[name]; !ok {
+				obj[name] = map[string]interface{}{"id": v}
+			}
+		}
+		if _, ok := obj["status"]; !ok && kind == "issue" {
+			// New issues start out in the "New" status
+			obj["status"] = map[string]interface{}{"id": 1, "name": "New"}
+		}
+	}
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return []byte("{}")
+	}
+	return buf
+}
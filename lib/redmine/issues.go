@@ -8,8 +8,10 @@ package redmine
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -44,17 +46,85 @@ type Issue struct {
 	IsPrivate      bool               `json:"is_private,omitempty"`
 	EstimatedHours float64            `json:"estimated_hours,omitempty"`
 	Notes          string             `json:"notes,omitempty"`
+	CreatedOn      string             `json:"created_on,omitempty"`
+	UpdatedOn      string             `json:"updated_on,omitempty"`
+	Author         *IDName            `json:"author,omitempty"`
+	CustomFields   []CustomFieldValue `json:"custom_fields,omitempty"`
+
+	// Only returned by GetIssueWithIncludes
+	Children   []*IssueChild `json:"children,omitempty"`
+	Relations  []Relation    `json:"relations,omitempty"`
+	Journals   []Journal     `json:"journals,omitempty"`
+	Changesets []Changeset   `json:"changesets,omitempty"`
+}
+
+type IssueChild struct {
+	ID       int           `json:"id"`
+	Tracker  *IDName       `json:"tracker"`
+	Subject  string        `json:"subject"`
+	Children []*IssueChild `json:"children,omitempty"`
+}
+
+type Relation struct {
+	ID           int    `json:"id"`
+	IssueID      int    `json:"issue_id"`
+	IssueToID    int    `json:"issue_to_id"`
+	RelationType string `json:"relation_type"`
+	Delay        *int   `json:"delay"`
+}
+
+type Journal struct {
+	ID        int             `json:"id"`
+	User      *IDName         `json:"user"`
+	Notes     string          `json:"notes"`
+	CreatedOn string          `json:"created_on"`
+	Details   []JournalDetail `json:"details"`
+}
+
+type JournalDetail struct {
+	Property string `json:"property"`
+	Name     string `json:"name"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+type Changeset struct {
+	Revision    string  `json:"revision"`
+	User        *IDName `json:"user"`
+	Comments    string  `json:"comments"`
+	CommittedOn string  `json:"committed_on"`
+}
+
+// ReleaseRef returns the release the issue is associated with, or nil. Read
+// operations return the release wrapped in a map with a single "release"
+// key.
+func (i *Issue) ReleaseRef() *IDName {
+	if i.Release == nil || i.Release["release"] == nil || i.Release["release"].ID == 0 {
+		return nil
+	}
+	return i.Release["release"]
 }
 
 type IssueFilter struct {
-	ProjectID string
-	StatusID  string
-	Subject   string
-	ParentID  string
-	VersionID string
-	ReleaseID string
+	ProjectID    string
+	StatusID     string
+	Subject      string
+	ParentID     string
+	VersionID    string
+	ReleaseID    string
+	TrackerID    string
+	AssignedToID string
+	UpdatedOn    string         // e.g. ">=2022-01-31"
+	QueryID      string         // ID of a saved query
+	IssueID      string         // comma separated issue IDs
+	CustomFields map[int]string // custom field ID to filter value, e.g. "*" (any)
+	Sort         string         // e.g. "updated_on:desc"
 }
 
+// ErrStop can be returned by the callback of EachIssue to stop the iteration
+// without an error.
+var ErrStop = errors.New("stop iteration")
+
 type issuesResult struct {
 	Issues     []Issue `json:"issues"`
 	TotalCount uint    `json:"total_count"`
@@ -92,6 +162,32 @@ func issueFilters(issueFilter *IssueFilter) []string {
 	if len(issueFilter.ReleaseID) > 0 {
 		filterParameters = append(filterParameters, fmt.Sprintf("release_id=%v", issueFilter.ReleaseID))
 	}
+	if len(issueFilter.TrackerID) > 0 {
+		filterParameters = append(filterParameters, "tracker_id="+url.QueryEscape(issueFilter.TrackerID))
+	}
+	if len(issueFilter.AssignedToID) > 0 {
+		filterParameters = append(filterParameters, "assigned_to_id="+url.QueryEscape(issueFilter.AssignedToID))
+	}
+	if len(issueFilter.UpdatedOn) > 0 {
+		filterParameters = append(filterParameters, "updated_on="+url.QueryEscape(issueFilter.UpdatedOn))
+	}
+	if len(issueFilter.QueryID) > 0 {
+		filterParameters = append(filterParameters, "query_id="+url.QueryEscape(issueFilter.QueryID))
+	}
+	if len(issueFilter.IssueID) > 0 {
+		filterParameters = append(filterParameters, "issue_id="+url.QueryEscape(issueFilter.IssueID))
+	}
+	var cfIDs []int
+	for id := range issueFilter.CustomFields {
+		cfIDs = append(cfIDs, id)
+	}
+	sort.Ints(cfIDs)
+	for _, id := range cfIDs {
+		filterParameters = append(filterParameters, fmt.Sprintf("cf_%d=%s", id, url.QueryEscape(issueFilter.CustomFields[id])))
+	}
+	if len(issueFilter.Sort) > 0 {
+		filterParameters = append(filterParameters, "sort="+url.QueryEscape(issueFilter.Sort))
+	}
 
 	return filterParameters
 }
@@ -100,33 +196,55 @@ func issueFilters(issueFilter *IssueFilter) []string {
 // This function handles pagination internally, so it could return a lot
 // of results at once.
 func (c *Client) FilteredIssues(f *IssueFilter) ([]Issue, error) {
+	var issues []Issue
+	err := c.EachIssue(f, func(i Issue) error {
+		issues = append(issues, i)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+// EachIssue calls fn for every issue that matches the f criteria, fetching
+// the next page of results only when the previous one has been processed.
+// If fn returns ErrStop, EachIssue stops and returns nil; any other error is
+// returned as is.
+func (c *Client) EachIssue(f *IssueFilter, fn func(Issue) error) error {
 	s := issueFilters(f)
 
-	var issues []Issue
 	var offset int
 	// Get 100 results at once (the default is 25)
 	limit := 100
 	for {
-		parameters := append(s, fmt.Sprintf("offset=%d", offset), fmt.Sprintf("limit=%d", limit))
+		parameters := append(append([]string{}, s...), fmt.Sprintf("offset=%d", offset), fmt.Sprintf("limit=%d", limit))
 		res, err := c.Get("/issues.json?" + strings.Join(parameters, "&"))
 		if err != nil {
-			return nil, err
+			return err
 		}
-		defer res.Body.Close()
 
 		var r issuesResult
 		err = responseHelper(res, &r, 200)
+		res.Body.Close()
 		if err != nil {
-			return nil, err
+			return err
+		}
+		for _, i := range r.Issues {
+			err = fn(i)
+			if err == ErrStop {
+				return nil
+			} else if err != nil {
+				return err
+			}
 		}
-		issues = append(issues, r.Issues...)
-		if r.Offset+uint(len(r.Issues)) >= r.TotalCount {
+		if len(r.Issues) == 0 || r.Offset+uint(len(r.Issues)) >= r.TotalCount {
 			break
 		}
 		offset += limit
 	}
 
-	return issues, nil
+	return nil
 }
 
 // CreateIssue creates a redmine issue
@@ -148,12 +266,34 @@ func (c *Client) CreateIssue(issue Issue) (*Issue, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = c.record(AuditEntry{
+		Method:   "POST",
+		Path:     "/issues.json",
+		Object:   "issue",
+		ObjectID: r.Issue.ID,
+		Action:   "create",
+		Changes:  fieldChanges(nil, IssueFields(r.Issue)),
+	})
+	if err != nil {
+		return nil, err
+	}
 	return &r.Issue, nil
 }
 
 // GetIssue retrieves a redmine Issue object by id
 func (c *Client) GetIssue(ID int) (*Issue, error) {
-	res, err := c.Get("/issues/" + strconv.Itoa(ID) + ".json")
+	return c.GetIssueWithIncludes(ID)
+}
+
+// GetIssueWithIncludes retrieves a redmine Issue object by id, including the
+// given associated data: "children", "relations", "journals", "changesets",
+// "attachments" and/or "watchers".
+func (c *Client) GetIssueWithIncludes(ID int, include ...string) (*Issue, error) {
+	path := "/issues/" + strconv.Itoa(ID) + ".json"
+	if len(include) > 0 {
+		path += "?include=" + strings.Join(include, ",")
+	}
+	res, err := c.Get(path)
 	if err != nil {
 		return nil, err
 	}
@@ -174,21 +314,79 @@ func (c *Client) GetIssue(ID int) (*Issue, error) {
 func (c *Client) UpdateIssue(issue Issue) error {
 	var ir issueWrapper
 	issue.ProjectID = issue.Project.ID
+	// Associated data can not be updated this way
+	issue.Children, issue.Relations, issue.Journals, issue.Changesets = nil, nil, nil, nil
+	// Custom field values may be stale, and sending them back would
+	// overwrite the changes made since the issue was read
+	issue.CustomFields = nil
 	ir.Issue = issue
 	s, err := json.Marshal(ir)
 	if err != nil {
 		return err
 	}
-	res, err := c.Put("/issues/"+strconv.Itoa(issue.ID)+".json", string(s))
+	return c.putIssue(issue.ID, s, IssueFields(issue))
+}
+
+// UpdateIssueFields updates only the given fields of the issue with the given
+// ID. Field names are the ones Redmine expects in update requests (e.g.
+// release_id); an empty string clears a field.
+func (c *Client) UpdateIssueFields(ID int, fields map[string]interface{}) error {
+	s, err := json.Marshal(map[string]interface{}{"issue": fields})
+	if err != nil {
+		return err
+	}
+	return c.putIssue(ID, s, fields)
+}
+
+// putIssue sends an issue update, recording the changes to the given fields
+// in the audit log.
+func (c *Client) putIssue(ID int, payload []byte, fields map[string]interface{}) error {
+	var before map[string]interface{}
+	if c.auditing() {
+		old, err := c.GetIssue(ID)
+		if err != nil {
+			return err
+		}
+		before = IssueFields(*old)
+	}
+	path := "/issues/" + strconv.Itoa(ID) + ".json"
+	res, err := c.Put(path, string(payload))
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 	if res.StatusCode == 404 {
-		return fmt.Errorf("Issue with id %d not found", issue.ID)
+		return fmt.Errorf("Issue with id %d not found", ID)
 	}
 
-	return responseHelper(res, nil, 204)
+	err = responseHelper(res, nil, 204)
+	if err != nil {
+		return err
+	}
+	after := make(map[string]interface{})
+	for k, v := range fields {
+		if k == "notes" {
+			// Notes are added to the history, they can not be undone
+			continue
+		}
+		if v == "" {
+			// Cleared fields are absent from IssueFields
+			v = nil
+		}
+		after[k] = v
+	}
+	changes := fieldChanges(before, after)
+	if before == nil || len(changes) == 0 {
+		return nil
+	}
+	return c.record(AuditEntry{
+		Method:   "PUT",
+		Path:     path,
+		Object:   "issue",
+		ObjectID: ID,
+		Action:   "update",
+		Changes:  changes,
+	})
 }
 
 // FindOrCreateIssue finds or creates an issue with a given subject, parentID, versionID and projectID
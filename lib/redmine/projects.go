@@ -7,6 +7,7 @@
 package redmine
 
 import (
+	"fmt"
 	"strconv"
 )
 
@@ -15,7 +16,10 @@ type projectWrapper struct {
 }
 
 type projectsResult struct {
-	Projects []Project `json:"projects"`
+	Projects   []Project `json:"projects"`
+	TotalCount uint      `json:"total_count"`
+	Offset     uint      `json:"offset"`
+	Limit      uint      `json:"limit"`
 }
 
 type Project struct {
@@ -57,3 +61,68 @@ func (c *Client) GetProjectByName(name string) (*Project, error) {
 	}
 	return &r.Project, nil
 }
+
+type membershipsResult struct {
+	Memberships []Membership `json:"memberships"`
+	TotalCount  uint         `json:"total_count"`
+	Offset      uint         `json:"offset"`
+	Limit       uint         `json:"limit"`
+}
+
+// Membership is the membership of a user (or group) in a project
+type Membership struct {
+	ID      int     `json:"id"`
+	Project *IDName `json:"project"`
+	User    *IDName `json:"user,omitempty"`
+	Group   *IDName `json:"group,omitempty"`
+}
+
+// Projects returns all projects visible to the user
+func (c *Client) Projects() ([]Project, error) {
+	var projects []Project
+	var offset int
+	limit := 100
+	for {
+		res, err := c.Get(fmt.Sprintf("/projects.json?offset=%d&limit=%d", offset, limit))
+		if err != nil {
+			return nil, err
+		}
+		var r projectsResult
+		err = responseHelper(res, &r, 200)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, r.Projects...)
+		if len(r.Projects) == 0 || r.Offset+uint(len(r.Projects)) >= r.TotalCount {
+			break
+		}
+		offset += limit
+	}
+	return projects, nil
+}
+
+// Memberships returns the members of a project, given its ID or identifier
+func (c *Client) Memberships(project string) ([]Membership, error) {
+	var memberships []Membership
+	var offset int
+	limit := 100
+	for {
+		res, err := c.Get(fmt.Sprintf("/projects/%s/memberships.json?offset=%d&limit=%d", project, offset, limit))
+		if err != nil {
+			return nil, err
+		}
+		var r membershipsResult
+		err = responseHelper(res, &r, 200)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, r.Memberships...)
+		if len(r.Memberships) == 0 || r.Offset+uint(len(r.Memberships)) >= r.TotalCount {
+			break
+		}
+		offset += limit
+	}
+	return memberships, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+import (
+	"fmt"
+)
+
+type queriesResult struct {
+	Queries    []Query `json:"queries"`
+	TotalCount uint    `json:"total_count"`
+	Offset     uint    `json:"offset"`
+	Limit      uint    `json:"limit"`
+}
+
+// Query is a saved issue query
+type Query struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	IsPublic  bool   `json:"is_public"`
+	ProjectID int    `json:"project_id"`
+}
+
+// Queries returns all saved queries visible to the user
+func (c *Client) Queries() ([]Query, error) {
+	var queries []Query
+	var offset int
+	limit := 100
+	for {
+		res, err := c.Get(fmt.Sprintf("/queries.json?offset=%d&limit=%d", offset, limit))
+		if err != nil {
+			return nil, err
+		}
+		var r queriesResult
+		err = responseHelper(res, &r, 200)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, r.Queries...)
+		if len(r.Queries) == 0 || r.Offset+uint(len(r.Queries)) >= r.TotalCount {
+			break
+		}
+		offset += limit
+	}
+	return queries, nil
+}
@@ -7,17 +7,26 @@
 package redmine
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 type Client struct {
 	endpoint string
 	apikey   string
 	*http.Client
+
+	dryRun      bool
+	strictNames bool
+	audit       *AuditLog
+	user        string
+	userOnce    sync.Once
 }
 
 type errorsResult struct {
@@ -34,7 +43,30 @@ type ID struct {
 }
 
 func NewClient(endpoint, apikey string) *Client {
-	return &Client{endpoint, apikey, http.DefaultClient}
+	return &Client{endpoint: endpoint, apikey: apikey, Client: http.DefaultClient}
+}
+
+// StrictNames makes the client only accept names that match exactly, or as
+// the end of a longer name, when looking up objects by name. Commands that
+// change issues use it, so that a partial name (e.g. "2.7" for "Arvados
+// 2.7.1") can not silently select the wrong object.
+func (c *Client) StrictNames() {
+	c.strictNames = true
+}
+
+// DryRun makes the client print every mutating request (anything other than
+// GET and HEAD) to w instead of sending it to the server. A plausible
+// response is synthesized for each intercepted request.
+func (c *Client) DryRun(w io.Writer) {
+	base := c.Client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Client = &http.Client{
+		Transport: &dryRunTransport{base: base, w: w},
+		Timeout:   c.Client.Timeout,
+	}
+	c.dryRun = true
 }
 
 func (c *Client) Get(url string) (*http.Response, error) {
@@ -78,6 +110,47 @@ func (c *Client) Put(url string, payload string) (*http.Response, error) {
 	return res, err
 }
 
+// Request sends an arbitrary request to the Redmine API, for the endpoints
+// this package does not model. A non-empty payload is sent as JSON. Requests
+// other than GET and HEAD that succeed are recorded in the audit log, but
+// they can not be undone.
+func (c *Client) Request(method, url string, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if len(payload) > 0 {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.endpoint+url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Add("X-Redmine-API-Key", c.apikey)
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if method != "GET" && method != "HEAD" && res.StatusCode/100 == 2 {
+		e := AuditEntry{
+			Method: method,
+			Path:   url,
+			Object: "api",
+			Action: strings.ToLower(method),
+		}
+		var v interface{}
+		if json.Unmarshal(payload, &v) == nil {
+			e.Changes = []Change{{Field: "payload", After: v}}
+		}
+		err = c.record(e)
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
 func responseHelper(res *http.Response, r interface{}, okCode int) error {
 	var err error
 	decoder := json.NewDecoder(res.Body)
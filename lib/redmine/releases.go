@@ -6,6 +6,7 @@ package redmine
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -96,7 +97,8 @@ func (c *Client) CreateRelease(release Release) (*Release, error) {
 	if err != nil {
 		return nil, err
 	}
-	res, err := c.Post("/rb/release/"+strings.ToLower(release.Project.Name)+"/new.json", string(s))
+	path := "/rb/release/" + strings.ToLower(release.Project.Name) + "/new.json"
+	res, err := c.Post(path, string(s))
 	if err != nil {
 		return nil, err
 	}
@@ -107,5 +109,43 @@ func (c *Client) CreateRelease(release Release) (*Release, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = c.record(AuditEntry{
+		Method:   "POST",
+		Path:     path,
+		Object:   "release",
+		ObjectID: r.Release.ID,
+		Action:   "create",
+		Changes:  []Change{{Field: "name", After: r.Release.Name}},
+	})
+	if err != nil {
+		return nil, err
+	}
 	return &r.Release, nil
 }
+
+type releasesResult struct {
+	Releases []Release `json:"releases"`
+}
+
+// errNoReleaseList is returned by Releases when the server does not provide
+// the release list API call
+var errNoReleaseList = errors.New("missing API call /rb/releases/project_id.json")
+
+// Releases returns all the releases of a project
+func (c *Client) Releases(project string) ([]Release, error) {
+	res, err := c.Get("/rb/releases/" + strings.ToLower(project) + ".json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, errNoReleaseList
+	}
+	var r releasesResult
+	err = responseHelper(res, &r, 200)
+	if err != nil {
+		return nil, err
+	}
+	return r.Releases, nil
+}
@@ -0,0 +1,321 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AmbiguousError is returned when a name matches several Redmine objects
+type AmbiguousError struct {
+	Kind       string
+	Name       string
+	Candidates []IDName
+}
+
+func (e *AmbiguousError) Error() string {
+	var names []string
+	for _, c := range e.Candidates {
+		names = append(names, fmt.Sprintf("'%s' (%d)", c.Name, c.ID))
+	}
+	return fmt.Sprintf("%s '%s' is ambiguous, it matches %s", e.Kind, e.Name, strings.Join(names, ", "))
+}
+
+// matchName finds the candidate called name. A case insensitive exact match
+// is preferred, then a candidate whose name ends with name as a whole word
+// (e.g. "3.0.0" for "Arvados 3.0.0", but neither "Arvados 3.0.0 RC" nor
+// "Arvados 13.0.0"), then, unless the client requires strict names (see
+// StrictNames), one that contains it. Several matches are reported as an
+// *AmbiguousError.
+func (c *Client) matchName(kind, name string, candidates []IDName) (IDName, error) {
+	var exact, suffix, partial []IDName
+	lname := strings.ToLower(name)
+	for _, cand := range candidates {
+		lc := strings.ToLower(cand.Name)
+		if lc == lname {
+			exact = append(exact, cand)
+		} else if hasWordSuffix(lc, lname) {
+			suffix = append(suffix, cand)
+		} else if strings.Contains(lc, lname) {
+			partial = append(partial, cand)
+		}
+	}
+	matches := exact
+	if len(matches) == 0 {
+		matches = suffix
+	}
+	if len(matches) == 0 && !c.strictNames {
+		matches = partial
+	}
+	switch len(matches) {
+	case 0:
+		return IDName{}, fmt.Errorf("unknown %s '%s'", kind, name)
+	case 1:
+		return matches[0], nil
+	}
+	return IDName{}, &AmbiguousError{Kind: kind, Name: name, Candidates: matches}
+}
+
+// hasWordSuffix tells whether s ends with suffix, starting at the beginning
+// of a word: "2.3.0" does not end with the word "3.0"
+func hasWordSuffix(s, suffix string) bool {
+	if !strings.HasSuffix(s, suffix) {
+		return false
+	}
+	prefix := s[:len(s)-len(suffix)]
+	if prefix == "" {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(prefix)
+	return unicode.IsSpace(r) || strings.ContainsRune("-_/:#(", r)
+}
+
+// ResolveStatus converts a status name (e.g. "In Progress") to the value of
+// the status_id issue filter. Numeric IDs and the special values "open",
+// "closed" and "*" are returned unchanged. Several statuses can be given
+// separated by commas.
+func (c *Client) ResolveStatus(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "open", "closed", "*":
+		return strings.ToLower(s), nil
+	}
+	var statuses []IDName
+	return resolveList(s, func(name string) (int, error) {
+		if statuses == nil {
+			all, err := c.IssueStatuses()
+			if err != nil {
+				return 0, err
+			}
+			for _, st := range all {
+				statuses = append(statuses, IDName{ID: st.ID, Name: st.Name})
+			}
+		}
+		m, err := c.matchName("issue status", name, statuses)
+		return m.ID, err
+	})
+}
+
+// ResolveTracker converts a tracker name (e.g. "Bug") to the value of the
+// tracker_id issue filter. Numeric IDs are returned unchanged. Several
+// trackers can be given separated by commas.
+func (c *Client) ResolveTracker(s string) (string, error) {
+	var trackers []IDName
+	return resolveList(s, func(name string) (int, error) {
+		if trackers == nil {
+			var err error
+			trackers, err = c.Trackers()
+			if err != nil {
+				return 0, err
+			}
+		}
+		m, err := c.matchName("tracker", name, trackers)
+		return m.ID, err
+	})
+}
+
+// resolveList resolves each comma separated name in s that is not already a
+// numeric ID, and joins the IDs with "|", which Redmine filters interpret as
+// "any of".
+func resolveList(s string, lookup func(string) (int, error)) (string, error) {
+	var ids []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if _, err := strconv.Atoi(name); err == nil {
+			ids = append(ids, name)
+			continue
+		}
+		id, err := lookup(name)
+		if err != nil {
+			return "", err
+		}
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return strings.Join(ids, "|"), nil
+}
+
+// ResolveProject converts a project name to its identifier. Identifiers and
+// numeric IDs are returned unchanged.
+func (c *Client) ResolveProject(s string) (string, error) {
+	if _, err := strconv.Atoi(s); err == nil {
+		return s, nil
+	}
+	projects, err := c.Projects()
+	if err != nil {
+		return "", err
+	}
+	var candidates []IDName
+	for _, p := range projects {
+		if p.IDentifier == s {
+			return s, nil
+		}
+		candidates = append(candidates, IDName{ID: p.ID, Name: p.Name})
+	}
+	m, err := c.matchName("project", s, candidates)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range projects {
+		if p.ID == m.ID {
+			return p.IDentifier, nil
+		}
+	}
+	return "", fmt.Errorf("unknown project '%s'", s)
+}
+
+// ResolveRelease converts the name of a release in project to its ID.
+// Numeric IDs are returned unchanged.
+func (c *Client) ResolveRelease(project, s string) (string, error) {
+	if _, err := strconv.Atoi(s); err == nil {
+		return s, nil
+	}
+	if project == "" {
+		return "", fmt.Errorf("a project is required to look up release '%s'", s)
+	}
+	releases, err := c.Releases(project)
+	if err == errNoReleaseList {
+		// Older servers can only look up a release by name by returning
+		// the first match, which may not be the right one
+		return "", fmt.Errorf("unable to look up release '%s': the server can not list the releases of project %s, use the release ID", s, project)
+	} else if err != nil {
+		return "", err
+	}
+	var candidates []IDName
+	for _, r := range releases {
+		candidates = append(candidates, IDName{ID: r.ID, Name: r.Name})
+	}
+	m, err := c.matchName("release", s, candidates)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(m.ID), nil
+}
+
+// ResolveSprint converts the name of a sprint (version) shared with project
+// to its ID. Numeric IDs are returned unchanged.
+func (c *Client) ResolveSprint(project, s string) (string, error) {
+	if _, err := strconv.Atoi(s); err == nil {
+		return s, nil
+	}
+	if project == "" {
+		return "", fmt.Errorf("a project is required to look up sprint '%s'", s)
+	}
+	p, err := c.GetProjectByName(project)
+	if err != nil {
+		return "", err
+	}
+	versions, err := c.Versions(p.ID)
+	if err != nil {
+		return "", err
+	}
+	var candidates []IDName
+	for _, v := range versions {
+		candidates = append(candidates, IDName{ID: v.ID, Name: v.Name})
+	}
+	m, err := c.matchName("sprint", s, candidates)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(m.ID), nil
+}
+
+// ResolveUser converts the name of a member of project to the user ID.
+// Numeric IDs and "me" are returned unchanged.
+func (c *Client) ResolveUser(project, s string) (string, error) {
+	if _, err := strconv.Atoi(s); err == nil || s == "me" {
+		return s, nil
+	}
+	if project == "" {
+		return "", fmt.Errorf("a project is required to look up user '%s'", s)
+	}
+	members, err := c.Memberships(project)
+	if err != nil {
+		return "", err
+	}
+	var candidates []IDName
+	for _, m := range members {
+		if m.User != nil {
+			candidates = append(candidates, *m.User)
+		}
+	}
+	m, err := c.matchName("user", s, candidates)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(m.ID), nil
+}
+
+// ResolveQuery converts the name of a saved query to its ID. Numeric IDs are
+// returned unchanged.
+func (c *Client) ResolveQuery(s string) (string, error) {
+	if _, err := strconv.Atoi(s); err == nil {
+		return s, nil
+	}
+	queries, err := c.Queries()
+	if err != nil {
+		return "", err
+	}
+	var candidates []IDName
+	for _, q := range queries {
+		candidates = append(candidates, IDName{ID: q.ID, Name: q.Name})
+	}
+	m, err := c.matchName("saved query", s, candidates)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(m.ID), nil
+}
+
+// ResolveIssue converts an issue subject to the ID of the issue in project.
+// Numeric IDs, with or without a leading "#", are returned unchanged. All
+// the issues whose subject contains s are compared, so that an exact match
+// is found however many partial ones there are.
+func (c *Client) ResolveIssue(project, s string) (string, error) {
+	if _, err := strconv.Atoi(strings.TrimPrefix(s, "#")); err == nil {
+		return strings.TrimPrefix(s, "#"), nil
+	}
+	f := IssueFilter{ProjectID: project, StatusID: "*", Subject: url.QueryEscape(s)}
+	var candidates []IDName
+	err := c.EachIssue(&f, func(i Issue) error {
+		candidates = append(candidates, IDName{ID: i.ID, Name: i.Subject})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	m, err := c.matchName("issue", s, candidates)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(m.ID), nil
+}
+
+// ResolveCustomField converts the name of an issue custom field to its ID.
+// Numeric IDs are returned unchanged. Looking up names requires
+// administrator rights.
+func (c *Client) ResolveCustomField(s string) (string, error) {
+	if _, err := strconv.Atoi(s); err == nil {
+		return s, nil
+	}
+	fields, err := c.CustomFields()
+	if err != nil {
+		return "", fmt.Errorf("unable to look up custom field '%s' (use its ID instead): %s", s, err)
+	}
+	var candidates []IDName
+	for _, f := range fields {
+		if f.CustomizedType == "issue" {
+			candidates = append(candidates, IDName{ID: f.ID, Name: f.Name})
+		}
+	}
+	m, err := c.matchName("custom field", s, candidates)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(m.ID), nil
+}
@@ -0,0 +1,76 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+import (
+	"testing"
+)
+
+func TestMatchName(t *testing.T) {
+	releases := []IDName{
+		{ID: 1, Name: "Arvados 2.3.0"},
+		{ID: 2, Name: "Arvados 2.7.1"},
+		{ID: 3, Name: "Arvados 3.0.0"},
+		{ID: 4, Name: "Arvados 3.0.0 RC"},
+		{ID: 5, Name: "Arvados 13.0.0"},
+		{ID: 6, Name: "arvados-2.7.2"},
+		{ID: 7, Name: "Future"},
+		{ID: 8, Name: "Future (maybe)"},
+	}
+	for _, tc := range []struct {
+		name   string
+		strict bool
+		id     int // 0 if unknown, -1 if ambiguous
+	}{
+		// Exact matches, case insensitive, are preferred
+		{"arvados 3.0.0", true, 3},
+		{"Future", true, 7},
+		// Suffixes that start a word
+		{"3.0.0", true, 3},
+		{"2.7.1", true, 2},
+		{"2.7.2", true, 6},
+		{"13.0.0", true, 5},
+		{"(maybe)", true, 8},
+		{"RC", true, 4},
+		// Suffixes inside a word are not matches
+		{"3.0", true, 0},
+		{"7.1", true, 0},
+		{"0.0", true, 0},
+		// Partial matches are only accepted without strict names
+		{"7.1", false, 2},
+		{"Arvados 2.3", false, 1},
+		{"Arvados 2.3", true, 0},
+		// Several matches of the best kind
+		{"2.7", false, -1},
+		{"3.0", false, -1},
+		{"0.0", false, -1},
+		{"arvados", false, -1},
+		{"Unknown", false, 0},
+	} {
+		c := &Client{strictNames: tc.strict}
+		m, err := c.matchName("release", tc.name, releases)
+		switch tc.id {
+		case 0:
+			if err == nil || err.Error() != "unknown release '"+tc.name+"'" {
+				t.Errorf("%q (strict %v): expected unknown release, got %v %v", tc.name, tc.strict, m, err)
+			}
+		case -1:
+			if _, ok := err.(*AmbiguousError); !ok {
+				t.Errorf("%q (strict %v): expected an ambiguous match, got %v %v", tc.name, tc.strict, m, err)
+			}
+		default:
+			if err != nil || m.ID != tc.id {
+				t.Errorf("%q (strict %v): expected %d, got %v %v", tc.name, tc.strict, tc.id, m, err)
+			}
+		}
+	}
+}
+
+func TestAmbiguousError(t *testing.T) {
+	err := &AmbiguousError{Kind: "release", Name: "2.7", Candidates: []IDName{{ID: 2, Name: "Arvados 2.7.1"}, {ID: 6, Name: "arvados-2.7.2"}}}
+	if expected := "release '2.7' is ambiguous, it matches 'Arvados 2.7.1' (2), 'arvados-2.7.2' (6)"; err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (C) The Arvados Authors. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package redmine
+
+type trackersResult struct {
+	Trackers []IDName `json:"trackers"`
+}
+
+type issueStatusesResult struct {
+	IssueStatuses []IssueStatus `json:"issue_statuses"`
+}
+
+type IssueStatus struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	IsClosed bool   `json:"is_closed"`
+}
+
+// Trackers returns all issue trackers (Bug, Feature, ...)
+func (c *Client) Trackers() ([]IDName, error) {
+	res, err := c.Get("/trackers.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var r trackersResult
+	err = responseHelper(res, &r, 200)
+	if err != nil {
+		return nil, err
+	}
+	return r.Trackers, nil
+}
+
+// IssueStatuses returns all issue statuses (New, In Progress, ...)
+func (c *Client) IssueStatuses() ([]IssueStatus, error) {
+	res, err := c.Get("/issue_statuses.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var r issueStatusesResult
+	err = responseHelper(res, &r, 200)
+	if err != nil {
+		return nil, err
+	}
+	return r.IssueStatuses, nil
+}
@@ -15,6 +15,7 @@ type userWrapper struct {
 
 type User struct {
 	ID          int    `json:"id"`
+	Login       string `json:"login"`
 	FirstName   string `json:"firstname"`
 	LastName    string `json:"lastname"`
 	Mail        string `json:"mail"`
@@ -40,3 +41,19 @@ func (c *Client) User(id int) (*User, error) {
 	}
 	return &r.User, nil
 }
+
+// CurrentUser returns the user the API key belongs to
+func (c *Client) CurrentUser() (*User, error) {
+	res, err := c.Get("/users/current.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var r userWrapper
+	err = responseHelper(res, &r, 200)
+	if err != nil {
+		return nil, err
+	}
+	return &r.User, nil
+}